@@ -2,95 +2,328 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ParseFlags parses flags and environment variables
 func ParseFlags() Config {
 
-	var provider, emailString, repoVisibility, token, username string
+	var concurrency int
+	var force bool
+	var configFile, provider, baseURL, cloneHost, caCert, organizations, localPaths, emailString, repoVisibility, token, username string
+	var extractor, extractorBinary, containerRuntime, extractorImage string
+	var cloneProtocol, sshKey, knownHosts, cloneStrategy, cloneSinceString string
+	var cloneDepth, scanDepth int
+	var sshFallback bool
+	var deleteClones bool
+	var keepClones int
+	var maxCloneSizeString string
+	var workspacePath, resultsPath, extractorPath string
+	var cloneTimeout, extractTimeout time.Duration
 
-	flag.StringVar(&provider, "provider", "github.com", "Provider for repos. Only github.com, bitbucket.org are supported now.")
-	flag.StringVar(&username, "username", "", "Username for Bitbucket Cloud account. Use with bitbucket.org")
+	flag.StringVar(&configFile, "config", "", "JSON file with multiple provider blocks (see README). When set, provider related flags are ignored.")
+	flag.StringVar(&provider, "provider", "github.com", "Provider for repos. Only github.com, bitbucket.org, bitbucket-server, gitlab.com, gitea, dev.azure.com and local are supported now.")
+	flag.StringVar(&baseURL, "base_url", "", "Base URL of a self-managed instance (e.g. \"https://gitlab.example.com\" or \"https://github.example.com\"). Use with gitlab.com, github.com, bitbucket-server, gitea and dev.azure.com (Azure DevOps Server url, collections go in -organizations)")
+	flag.StringVar(&cloneHost, "clone_host", "", "Host used for HTTPS cloning if it differs from the one returned by the API (e.g. \"git.example.com:8443\")")
+	flag.StringVar(&caCert, "ca_cert", "", "PEM file with the certificates of the CA which signed the certificate of a self-managed instance")
+	flag.StringVar(&organizations, "organizations", "", "Comma separated list of Azure DevOps organizations (e.g. \"fabrikam,contoso\"). Every organization of the user is used if it is not set. Use with dev.azure.com")
+	flag.StringVar(&localPaths, "local_paths", "", "Comma separated list of folders which are scanned for already cloned repositories. Use with local")
+	flag.IntVar(&scanDepth, "scan_depth", 3, "How many folder levels below -local_paths are scanned for repositories. Use with local")
+	flag.StringVar(&username, "username", "", "Username for Bitbucket Cloud and Bitbucket Server accounts. Use with bitbucket.org and bitbucket-server")
 	flag.StringVar(&token, "token", "", "For accessing repositories. You can also set this with TOKEN environment variable.")
 	flag.StringVar(&emailString, "emails", "", "Your emails which are used when making the commits. Provide a comma separated list for multiple emails (e.g. \"one@mail.com,two@email.com\")")
 	flag.StringVar(&repoVisibility, "repo_visibility", "private", "Which repos do you want to get processed? Options: all, public and private.")
 
-	flag.Parse()
+	flag.StringVar(&extractor, "extractor", "docker", "How repositories are extracted. Options: docker (repo_info_extractor docker script), binary (locally installed repo_info_extractor), container (podman, nerdctl or any docker compatible runtime) and native (built-in, no external tools needed).")
+	flag.StringVar(&extractorBinary, "extractor_binary", "repo_info_extractor", "Path of the repo_info_extractor binary. Use with -extractor=binary")
+	flag.StringVar(&containerRuntime, "container_runtime", "podman", "Docker compatible container runtime (e.g. podman, nerdctl). Use with -extractor=container")
+	flag.StringVar(&extractorImage, "extractor_image", "codersrank/repo_info_extractor:latest", "repo_info_extractor image. Use with -extractor=container")
+	flag.StringVar(&cloneProtocol, "clone_protocol", "https", "Protocol used for cloning repositories. Options: https and ssh.")
+	flag.StringVar(&sshKey, "ssh_key", "", "Private key file for SSH cloning. If not set ssh-agent is used. Passphrase can be set with SSH_KEY_PASSPHRASE environment variable. Use with -clone_protocol=ssh")
+	flag.StringVar(&knownHosts, "known_hosts", "", "known_hosts file used to verify SSH hosts (default ~/.ssh/known_hosts). Use with -clone_protocol=ssh")
+	flag.BoolVar(&sshFallback, "ssh_fallback_https", false, "Clone with HTTPS if SSH cloning fails. Use with -clone_protocol=ssh")
+	flag.StringVar(&cloneStrategy, "clone_strategy", "full", "How repositories are cloned. Options: full, single-branch (only the default branch), shallow (default branch limited with -clone_depth and -clone_since) and no-checkout (no files are checked out).")
+	flag.IntVar(&cloneDepth, "clone_depth", 100, "Number of commits cloned. Use with -clone_strategy=shallow")
+	flag.StringVar(&cloneSinceString, "clone_since", "", "Clone at least the commits made since this date (e.g. \"2019-01-31\"). Use with -clone_strategy=shallow")
+	flag.BoolVar(&force, "force", false, "Extract and upload every repository, even if it hasn't changed since the last run.")
+	flag.IntVar(&concurrency, "concurrency", 1, "Number of repositories cloned and processed in parallel.")
+	flag.BoolVar(&deleteClones, "delete_clones", false, "Delete clones after their repository is processed.")
+	flag.IntVar(&keepClones, "keep_clones", 0, "Keep only this many of the most recently used clones. 0 keeps every clone.")
+	flag.StringVar(&maxCloneSizeString, "max_clone_size", "", "Maximum disk space used by clones (e.g. \"500MB\", \"20GB\"). Least recently used clones are deleted above it.")
+	flag.StringVar(&workspacePath, "workspace_dir", "", "Folder of the clones (default ~/.cache/multi_repo_extractor/repos)")
+	flag.StringVar(&resultsPath, "results_dir", "", "Folder of the extraction results and the state of the previous runs (default ~/.cache/multi_repo_extractor/results)")
+	flag.StringVar(&extractorPath, "extractor_dir", "", "Folder of the repo_info_extractor clone. You can also set this with REPO_EXTRACTOR environment variable. Use with -extractor=docker (default ~/.cache/multi_repo_extractor/repo_info_extractor)")
+	flag.DurationVar(&cloneTimeout, "clone_timeout", time.Hour, "Maximum time of cloning or updating a single repository (e.g. \"30m\"). 0 means no limit.")
+	flag.DurationVar(&extractTimeout, "extract_timeout", time.Hour, "Maximum time of extracting a single repository (e.g. \"30m\"). 0 means no limit.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [command] [flags]\n\nCommands:\n  clean\tDelete clones of repositories the providers no longer return\n  resume\tContinue the interrupted run\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	// Command is optional, repositories are extracted and uploaded without it
+	var command string
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if command != "" && command != "clean" && command != "resume" {
+		log.Fatalf("Unknown command %s. Valid commands are: clean and resume.", command)
+	}
 
-	// After getting flags, check environment variables
-	// If there is an env_var and related variable hasn't specified as a flag, we will use it
-	// Which means flags override env_vars
+	var providers []ProviderConfig
+	var emails []string
+	if configFile != "" {
+		file, err := readConfigFile(configFile)
+		if err != nil {
+			log.Fatalf("Couldn't read config file %s: %s", configFile, err.Error())
+		}
+		providers = file.Providers
+		emails = file.Emails
+	} else {
+		// After getting flags, check environment variables
+		// If there is an env_var and related variable hasn't specified as a flag, we will use it
+		// Which means flags override env_vars
 
-	token = strings.TrimSpace(token)
+		token = strings.TrimSpace(token)
 
-	if len(token) == 0 {
-		if len(os.Getenv("TOKEN")) > 0 {
+		if len(token) == 0 && len(os.Getenv("TOKEN")) > 0 {
 			log.Printf("Taking token from env.")
 			token = os.Getenv("TOKEN")
-		} else {
-			log.Fatal("You need to provide a valid token.")
 		}
+
+		providers = []ProviderConfig{{
+			ProviderName:   provider,
+			BaseURL:        strings.TrimSpace(baseURL),
+			CloneHost:      cloneHost,
+			CACert:         caCert,
+			Organizations:  splitList(organizations),
+			Paths:          splitList(localPaths),
+			ScanDepth:      scanDepth,
+			Username:       username,
+			Token:          token,
+			RepoVisibility: repoVisibility,
+		}}
 	}
 
-	appPath := getAppPath()
-	repoInfoExtractorPath := getDefaultRepoInfoExtractorPath(appPath)
-	// Set this if you don't want to download repo_info_extractor and want to use your local version
-	if os.Getenv("REPO_EXTRACTOR") != "" {
-		repoInfoExtractorPath = os.Getenv("REPO_EXTRACTOR")
+	err := validateProviders(providers)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if provider != "bitbucket.org" && len(username) == 0 {
-		log.Fatal("Username is required for Bitbucket.org authentication.")
+	// Set this if you don't want to download repo_info_extractor and want to use your local version
+	if extractorPath == "" {
+		extractorPath = os.Getenv("REPO_EXTRACTOR")
+	}
+	managedExtractor := extractorPath == ""
+	if workspacePath == "" || resultsPath == "" || extractorPath == "" {
+		cachePath := getCachePath()
+		if workspacePath == "" {
+			workspacePath = filepath.Join(cachePath, "repos")
+		}
+		if resultsPath == "" {
+			resultsPath = filepath.Join(cachePath, "results")
+		}
+		if extractorPath == "" {
+			extractorPath = filepath.Join(cachePath, "repo_info_extractor")
+		}
+	}
+	err = absolutePaths(&workspacePath, &resultsPath, &extractorPath)
+	if err != nil {
+		log.Fatalf("Couldn't resolve folders: %s", err.Error())
+	}
+	for _, path := range []string{workspacePath, resultsPath} {
+		err := os.MkdirAll(path, 0700)
+		if err != nil {
+			log.Fatalf("Couldn't create %s: %s", path, err.Error())
+		}
 	}
 
-	var emails []string
-	if emailString == "" {
-		log.Fatal("You need to provide at least one email.")
-	} else {
+	if emailString != "" {
 		emails = strings.Split(emailString, ",")
-		for i := range emails {
-			emails[i] = strings.TrimSpace(emails[i])
+	}
+	for i := range emails {
+		emails[i] = strings.TrimSpace(emails[i])
+	}
+	if len(emails) == 0 {
+		log.Fatal("You need to provide at least one email.")
+	}
+
+	if extractor != "docker" && extractor != "binary" && extractor != "container" && extractor != "native" {
+		log.Fatal("Valid values for extractor are: docker, binary, container and native.")
+	}
+
+	if cloneProtocol != "https" && cloneProtocol != "ssh" {
+		log.Fatal("Valid values for clone_protocol are: https and ssh.")
+	}
+
+	if cloneStrategy != "full" && cloneStrategy != "single-branch" && cloneStrategy != "shallow" && cloneStrategy != "no-checkout" {
+		log.Fatal("Valid values for clone_strategy are: full, single-branch, shallow and no-checkout.")
+	}
+
+	if cloneDepth < 1 {
+		log.Fatal("Clone depth must be at least 1.")
+	}
+
+	var cloneSince time.Time
+	if cloneSinceString != "" {
+		var err error
+		cloneSince, err = time.Parse("2006-01-02", cloneSinceString)
+		if err != nil {
+			log.Fatal("Valid format for clone_since is YYYY-MM-DD.")
 		}
 	}
 
-	if repoVisibility != "all" && repoVisibility != "public" && repoVisibility != "private" {
-		log.Fatal("Valid values for repo_visibility are: all, public and private.")
+	if concurrency < 1 {
+		log.Fatal("Concurrency must be at least 1.")
+	}
+
+	if cloneTimeout < 0 || extractTimeout < 0 {
+		log.Fatal("Timeouts can't be negative.")
+	}
+
+	if keepClones < 0 {
+		log.Fatal("keep_clones can't be negative.")
+	}
+
+	var maxCloneSize int64
+	if maxCloneSizeString != "" {
+		var err error
+		maxCloneSize, err = parseSize(maxCloneSizeString)
+		if err != nil {
+			log.Fatalf("Invalid max_clone_size: %s", err.Error())
+		}
 	}
 
 	return Config{
-		ProviderName:          provider,
-		Username:              username,
-		Token:                 token,
-		Emails:                emails,
-		RepoVisibility:        repoVisibility,
-		AppPath:               appPath,
-		RepoInfoExtractorPath: repoInfoExtractorPath,
+		Command:                  command,
+		Providers:                providers,
+		Emails:                   emails,
+		WorkspacePath:            workspacePath,
+		ResultsPath:              resultsPath,
+		RepoInfoExtractorPath:    extractorPath,
+		ManagedRepoInfoExtractor: managedExtractor,
+		Extractor:                extractor,
+		ExtractorBinary:          extractorBinary,
+		ContainerRuntime:         containerRuntime,
+		ExtractorImage:           extractorImage,
+		Concurrency:              concurrency,
+		Force:                    force,
+		CloneProtocol:            cloneProtocol,
+		SSHKey:                   sshKey,
+		SSHKeyPassphrase:         os.Getenv("SSH_KEY_PASSPHRASE"),
+		KnownHosts:               knownHosts,
+		SSHFallback:              sshFallback,
+		CloneStrategy:            cloneStrategy,
+		CloneDepth:               cloneDepth,
+		CloneSince:               cloneSince,
+		DeleteClones:             deleteClones,
+		KeepClones:               keepClones,
+		MaxCloneSize:             maxCloneSize,
+		CloneTimeout:             cloneTimeout,
+		ExtractTimeout:           extractTimeout,
 	}
 }
 
-// Default path is relative to the current directory
-func getDefaultRepoInfoExtractorPath(appPath string) string {
-	return appPath + "/repo_info_extractor"
+// Extractors run in other working directories, so relative folders are resolved against the current one
+func absolutePaths(paths ...*string) error {
+	for _, path := range paths {
+		absolutePath, err := filepath.Abs(*path)
+		if err != nil {
+			return err
+		}
+		*path = absolutePath
+	}
+	return nil
 }
 
-func getAppPath() string {
-	appPath, err := os.Getwd()
+// Splits a comma separated flag value, empty items are dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+var sizeRegex = regexp.MustCompile(`^(\d+)\s*([KMGT]?B?)$`)
+
+// Parses sizes like "500MB" or "20GB" to bytes, units are powers of 1024
+func parseSize(size string) (int64, error) {
+	match := sizeRegex.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(size)))
+	if match == nil {
+		return 0, fmt.Errorf("%s is not a valid size, use a number with an optional unit (B, KB, MB, GB or TB)", size)
+	}
+	unit := match[2]
+	if len(unit) == 1 && unit != "B" {
+		unit += "B"
+	}
+	value, err := strconv.ParseInt(match[1], 10, 64)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
+	}
+	return value * sizeUnits[unit], nil
+}
+
+// Default folders are in the user's cache folder (e.g. $XDG_CACHE_HOME or ~/.cache on Linux),
+// so they don't depend on the directory the program is launched from
+func getCachePath() string {
+	cachePath, err := os.UserCacheDir()
+	if err != nil {
+		log.Fatalf("Couldn't find the cache folder, set -workspace_dir, -results_dir and -extractor_dir: %s", err.Error())
 	}
-	return appPath
+	return filepath.Join(cachePath, appName)
 }
 
 // Config flags and paths
 type Config struct {
-	ProviderName          string
-	Username              string
-	Token                 string
+	// Command is empty for extracting and uploading, "clean" or "resume"
+	Command               string
+	Providers             []ProviderConfig
 	Emails                []string
-	RepoVisibility        string
-	AppPath               string
+	WorkspacePath         string
+	ResultsPath           string
 	RepoInfoExtractorPath string
+	// ManagedRepoInfoExtractor is set when RepoInfoExtractorPath is the default folder in the cache.
+	// Checkouts of the user (-extractor_dir, REPO_EXTRACTOR) are never reset or deleted.
+	ManagedRepoInfoExtractor bool
+	Extractor                string
+	ExtractorBinary          string
+	ContainerRuntime         string
+	ExtractorImage           string
+	Concurrency              int
+	Force                    bool
+	CloneProtocol            string
+	SSHKey                   string
+	SSHKeyPassphrase         string
+	KnownHosts               string
+	SSHFallback              bool
+	CloneStrategy            string
+	CloneDepth               int
+	CloneSince               time.Time
+	DeleteClones             bool
+	KeepClones               int
+	// MaxCloneSize is the disk budget of clones in bytes, 0 means no limit
+	MaxCloneSize   int64
+	CloneTimeout   time.Duration
+	ExtractTimeout time.Duration
 }
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+
+	Describe("Resolving folders", func() {
+		It("should make relative folders absolute", func() {
+			workingDirectory, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			workspacePath, resultsPath := "ws", "../results"
+			extractorPath := filepath.Join(os.TempDir(), "repo_info_extractor")
+
+			Expect(absolutePaths(&workspacePath, &resultsPath, &extractorPath)).To(Succeed())
+			Expect(workspacePath).To(Equal(filepath.Join(workingDirectory, "ws")))
+			Expect(resultsPath).To(Equal(filepath.Join(filepath.Dir(workingDirectory), "results")))
+			Expect(extractorPath).To(Equal(filepath.Join(os.TempDir(), "repo_info_extractor")))
+		})
+	})
+
+})
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// NewHTTPClient returns a client which trusts the given CA bundles (PEM files) besides the system ones.
+// Without bundles the default transport is used.
+func NewHTTPClient(caCertPaths ...string) (*http.Client, error) {
+	if len(caCertPaths) == 0 {
+		return &http.Client{}, nil
+	}
+	certPool, err := loadCertPool(caCertPaths)
+	if err != nil {
+		return nil, err
+	}
+	var transport *http.Transport
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = defaultTransport.Clone()
+	} else {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+	transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	return &http.Client{Transport: transport}, nil
+}
+
+func loadCertPool(caCertPaths []string) (*x509.CertPool, error) {
+	// System pool isn't available on every platform (e.g. Windows before Go 1.18)
+	certPool, err := x509.SystemCertPool()
+	if err != nil || certPool == nil {
+		certPool = x509.NewCertPool()
+	}
+	for _, path := range caCertPaths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if !certPool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("%s doesn't contain any PEM encoded certificates", path)
+		}
+	}
+	return certPool, nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ProviderConfig credentials and filters of a single provider block
+type ProviderConfig struct {
+	// Name identifies the block, it must be unique. Defaults to ProviderName.
+	Name         string `json:"name"`
+	ProviderName string `json:"provider"`
+	BaseURL      string `json:"base_url"`
+	// CloneHost replaces the host of HTTPS clone urls, e.g. when the API of
+	// a self-hosted instance returns an internal host name
+	CloneHost string `json:"clone_host"`
+	// CACert is a PEM file with the certificates of a self-signed or internal CA
+	CACert string `json:"ca_cert"`
+	// Organizations limits Azure DevOps to the given organizations (or collections of a server),
+	// every organization of the user is used if it is empty
+	Organizations []string `json:"organizations"`
+	// Paths are scanned for repositories by the local provider
+	Paths []string `json:"paths"`
+	// ScanDepth is how many folder levels below Paths are scanned, 0 means the default
+	ScanDepth int    `json:"scan_depth"`
+	Username  string `json:"username"`
+	Token     string `json:"token"`
+	// TokenEnv is the name of an environment variable holding the token,
+	// so tokens don't have to be stored in the config file.
+	TokenEnv       string `json:"token_env"`
+	RepoVisibility string `json:"repo_visibility"`
+}
+
+type configFile struct {
+	Emails    []string         `json:"emails"`
+	Providers []ProviderConfig `json:"providers"`
+}
+
+var providerNameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Values of the "provider" field which have an implementation
+var supportedProviders = []string{"github.com", "bitbucket.org", "bitbucket-server", "gitlab.com", "gitea", "dev.azure.com", "local"}
+
+func readConfigFile(path string) (*configFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file configFile
+	err = json.Unmarshal(content, &file)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Providers) == 0 {
+		return nil, errors.New("at least one provider block is required")
+	}
+	for i := range file.Providers {
+		if file.Providers[i].RepoVisibility == "" {
+			file.Providers[i].RepoVisibility = "private"
+		}
+		if file.Providers[i].Token == "" && file.Providers[i].TokenEnv != "" {
+			file.Providers[i].Token = os.Getenv(file.Providers[i].TokenEnv)
+		}
+	}
+	return &file, nil
+}
+
+// Fills default names and checks that every provider block is usable
+func validateProviders(providers []ProviderConfig) error {
+	names := make(map[string]bool, len(providers))
+	for i := range providers {
+		p := &providers[i]
+		p.Token = strings.TrimSpace(p.Token)
+		p.BaseURL = strings.TrimSpace(p.BaseURL)
+		p.CloneHost = strings.TrimSpace(p.CloneHost)
+		p.CACert = strings.TrimSpace(p.CACert)
+		if p.Name == "" {
+			p.Name = p.ProviderName
+		}
+		if !providerNameRegex.MatchString(p.Name) {
+			return fmt.Errorf("Invalid provider name %q, only letters, digits, '.', '_' and '-' are allowed.", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("Provider name %q is used more than once, set a unique \"name\" for each provider block.", p.Name)
+		}
+		names[p.Name] = true
+		if !isSupportedProvider(p.ProviderName) {
+			return fmt.Errorf("Unknown provider %q (%s), supported providers are: %s.", p.ProviderName, p.Name, strings.Join(supportedProviders, ", "))
+		}
+
+		// Local repositories don't need credentials, only the folders to scan
+		if p.ProviderName == "local" {
+			if len(p.Paths) == 0 {
+				return fmt.Errorf("At least one path is required for local repositories (%s).", p.Name)
+			}
+			for _, path := range p.Paths {
+				if info, err := os.Stat(path); err != nil || !info.IsDir() {
+					return fmt.Errorf("%s is not a folder (%s).", path, p.Name)
+				}
+			}
+			continue
+		}
+
+		if len(p.Token) == 0 {
+			return fmt.Errorf("You need to provide a valid token for %s.", p.Name)
+		}
+		if p.ProviderName == "bitbucket.org" && len(p.Username) == 0 {
+			return fmt.Errorf("Username is required for Bitbucket.org authentication (%s).", p.Name)
+		}
+		// Organizations of the user can only be listed on dev.azure.com
+		if p.ProviderName == "dev.azure.com" && len(p.BaseURL) > 0 && len(p.Organizations) == 0 {
+			return fmt.Errorf("Organizations are required for Azure DevOps Server (%s).", p.Name)
+		}
+		if p.ProviderName == "gitea" && len(p.BaseURL) == 0 {
+			return fmt.Errorf("Base URL of the instance is required for Gitea (%s).", p.Name)
+		}
+		if p.ProviderName == "bitbucket-server" {
+			if len(p.BaseURL) == 0 {
+				return fmt.Errorf("Base URL of the instance is required for Bitbucket Server (%s).", p.Name)
+			}
+			// Personal access tokens are used with the username for cloning
+			if len(p.Username) == 0 {
+				return fmt.Errorf("Username is required for cloning from Bitbucket Server (%s).", p.Name)
+			}
+		}
+		if p.CACert != "" {
+			if _, err := loadCertPool([]string{p.CACert}); err != nil {
+				return fmt.Errorf("Couldn't load CA bundle of %s: %s", p.Name, err.Error())
+			}
+		}
+		if p.RepoVisibility != "all" && p.RepoVisibility != "public" && p.RepoVisibility != "private" {
+			return fmt.Errorf("Valid values for repo_visibility are: all, public and private (%s).", p.Name)
+		}
+	}
+	return nil
+}
+
+func isSupportedProvider(providerName string) bool {
+	for _, supported := range supportedProviders {
+		if providerName == supported {
+			return true
+		}
+	}
+	return false
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -75,28 +76,55 @@ func download(downloadURL string) error {
 	}
 	defer resp.Body.Close()
 
-	appPath, err := os.Getwd()
+	// The running binary is replaced, whatever its name is and wherever the program is launched from
+	filePath, err := getExecutablePath()
 	if err != nil {
 		return err
 	}
-	filePath := appPath + "/" + appName
 
-	out, err := os.Create(filePath)
+	// Download to a temporary file next to the binary first, so a failed download doesn't leave
+	// a broken binary behind and the new one can be renamed onto the running one
+	out, err := ioutil.TempFile(filepath.Dir(filePath), "."+appName+"-")
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer os.Remove(out.Name())
 
 	_, err = io.Copy(out, resp.Body)
+	closeErr := out.Close()
 	if err != nil {
-		fmt.Printf("New binary saved to %s\n", filePath)
-	} else {
-		chmodErr := os.Chmod(filePath, 0755)
-		if chmodErr != nil {
-			fmt.Printf("Couldn't set execute permissions for %s\n", filePath)
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	err = os.Chmod(out.Name(), 0755)
+	if err != nil {
+		fmt.Printf("Couldn't set execute permissions for %s\n", filePath)
+	}
+	// Windows doesn't allow replacing a running binary, but it can be moved out of the way
+	if runtime.GOOS == "windows" {
+		oldPath := filePath + ".old"
+		os.Remove(oldPath)
+		err = os.Rename(filePath, oldPath)
+		if err != nil {
+			return err
 		}
 	}
-	return err
+	err = os.Rename(out.Name(), filePath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New binary saved to %s\n", filePath)
+	return nil
+}
+
+func getExecutablePath() (string, error) {
+	executablePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(executablePath)
 }
 
 func getRelease() (*release, error) {
@@ -1,8 +1,30 @@
 package entity
 
+import "regexp"
+
 // Repository is the internal representation of external repository information
 type Repository struct {
 	ID       string
 	FullName string
 	Name     string
+	// Provider is the name of the provider block the repository comes from
+	Provider string
+	// CloneURL is the HTTPS clone URL without credentials. When it is empty
+	// the clone URL is derived from the provider name and FullName.
+	CloneURL string
+	// SSHURL is the SSH clone URL, empty if the provider doesn't support SSH
+	SSHURL string
+	// DefaultBranch is used by the single-branch and shallow clone strategies, HEAD is used if it is empty
+	DefaultBranch string
+	// LocalPath is set for repositories which are already on disk, they are
+	// extracted where they are and never cloned, updated or deleted
+	LocalPath string
+}
+
+var unsafeIDCharacters = regexp.MustCompile(`[^A-Za-z0-9._{}-]`)
+
+// UniqueID returns an ID which is unique across providers and safe to use in file names.
+// IDs are only unique within a single provider (e.g. GitHub and GitLab both use numeric IDs).
+func (r *Repository) UniqueID() string {
+	return unsafeIDCharacters.ReplaceAllString(r.Provider+"-"+r.ID, "_")
 }
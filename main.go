@@ -1,26 +1,135 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/gookit/color"
+
 	"github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
 	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
 	"github.com/codersrank-org/multi_repo_repo_extractor/repo"
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
 	"github.com/codersrank-org/multi_repo_repo_extractor/upload"
 )
 
 func main() {
 	config.CheckUpdates()
 	config := config.ParseFlags()
+	ctx := handleSignals()
 
-	providers := make([]provider.Provider, 1)
-	providers[0] = provider.NewProvider(config)
-	repositoryService := repo.NewRepositoryService(config)
-	codersrankService := upload.NewCodersrankService(config)
+	providers := make([]provider.Provider, len(config.Providers))
+	for i, providerConfig := range config.Providers {
+		p, err := provider.NewProvider(providerConfig)
+		if err != nil {
+			log.Fatalf("Couldn't create provider: %s", err.Error())
+		}
+		providers[i] = p
+	}
+	// State of the previous runs, used to skip repositories which haven't changed
+	store, err := state.NewStore(filepath.Join(config.ResultsPath, "state.json"))
+	if err != nil {
+		log.Fatalf("Couldn't read state file: %s", err.Error())
+	}
+	// Progress of the current run, used to resume an interrupted run
+	journal, err := state.NewJournal(filepath.Join(config.ResultsPath, "journal.json"))
+	if err != nil {
+		log.Fatalf("Couldn't read journal file: %s", err.Error())
+	}
+	repositoryService := repo.NewRepositoryService(config, store, journal)
+	codersrankService := upload.NewCodersrankService(config, store, journal)
+
+	if config.Command == "resume" {
+		if !journal.Unfinished() {
+			color.Warn.Println("There is no interrupted run to resume.")
+			return
+		}
+		processedRepos := repositoryService.ProcessRepos(ctx, journal.Repos())
+		if interrupted(ctx) {
+			return
+		}
+		uploadRepos(ctx, codersrankService, processedRepos)
+		return
+	}
 
 	repos := make([]*entity.Repository, 0)
-	for _, provider := range providers {
-		repos = append(repos, provider.GetRepos()...)
+	// Providers which returned their repositories
+	listedProviders := make([]string, 0, len(providers))
+	for i, provider := range providers {
+		providerRepos, err := provider.GetRepos(ctx)
+		if err != nil {
+			// Other providers can still be processed
+			fmt.Printf("Couldn't get repositories from %s. Error: %s\n", config.Providers[i].Name, color.Danger.Sprint(err.Error()))
+			continue
+		}
+		repos = append(repos, providerRepos...)
+		listedProviders = append(listedProviders, config.Providers[i].Name)
+	}
+	// Nothing to resume yet, repositories of the previous run are kept in the journal
+	if ctx.Err() != nil {
+		color.Warn.Println("Run was interrupted while listing repositories.")
+		return
+	}
+	if config.Command == "clean" {
+		err = repositoryService.RemoveOrphans(repos, listedProviders)
+		if err != nil {
+			log.Fatalf("Couldn't clean up: %s", err.Error())
+		}
+		return
+	}
+	if len(repos) == 0 {
+		color.Warn.Println("No repositories found, nothing to extract.")
+		return
+	}
+	if journal.Unfinished() {
+		color.Warn.Println("The previous run was interrupted, starting a new one. Use the resume command to continue an interrupted run.")
+	}
+	err = journal.Start(repos)
+	if err != nil {
+		log.Fatalf("Couldn't save journal file: %s", err.Error())
+	}
+	processedRepos := repositoryService.ProcessRepos(ctx, repos)
+	if interrupted(ctx) {
+		return
+	}
+	uploadRepos(ctx, codersrankService, processedRepos)
+}
+
+// Failed uploads are reported with a non-zero exit status
+func uploadRepos(ctx context.Context, codersrankService upload.CodersrankService, repos []*entity.Repository) {
+	err := codersrankService.UploadRepos(ctx, repos)
+	if err != nil {
+		color.Danger.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+// Returned context is cancelled on SIGINT or SIGTERM, so the running work can be stopped and rolled back.
+// Second signal exits immediately.
+func handleSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		color.Warn.Println("Stopping, repositories in progress are rolled back. Press Ctrl-C again to exit immediately.")
+		cancel()
+		<-signals
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+func interrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
 	}
-	processedRepos := repositoryService.ProcessRepos(repos)
-	codersrankService.UploadRepos(processedRepos)
+	color.Warn.Println("Run was interrupted, use the resume command to continue it.")
+	return true
 }
@@ -0,0 +1,219 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+const azureAPIVersion = "6.0"
+
+// AzureProvider used for handling Azure DevOps Services and Server API operations
+type AzureProvider struct {
+	Name string
+	// BaseURL is https://dev.azure.com or the server url of an Azure DevOps Server (e.g. https://tfs.example.com/tfs),
+	// the collections of a server are listed in Organizations
+	BaseURL string
+	// ProfileAPI lists the organizations of the user, only available on Azure DevOps Services
+	ProfileAPI    string
+	Organizations []string
+	Token         string
+	Visibility    string
+	Retry         retry.Policy
+	Client        *http.Client
+}
+
+// NewAzureProvider constructor
+func NewAzureProvider(c config.ProviderConfig) (*AzureProvider, error) {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = "https://dev.azure.com"
+	}
+	client, err := newHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &AzureProvider{
+		Name:          c.Name,
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		ProfileAPI:    "https://app.vssps.visualstudio.com/_apis",
+		Organizations: c.Organizations,
+		Token:         c.Token,
+		Visibility:    c.RepoVisibility,
+		Retry:         retry.APIPolicy,
+		Client:        client,
+	}, nil
+}
+
+// GetRepos returns the repositories of every project of the organizations with given token and visibility
+func (p *AzureProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
+	organizations := p.Organizations
+	if len(organizations) == 0 {
+		var err error
+		organizations, err = p.getOrganizations(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	repos := make([]*entity.Repository, 0)
+	for _, organization := range organizations {
+		projects, err := p.getProjects(ctx, organization)
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range projects {
+			// Projects visible to the whole enterprise are not public, so they are listed as private ones
+			private := project.Visibility != "public"
+			if (p.Visibility == "public" && private) || (p.Visibility == "private" && !private) {
+				continue
+			}
+			projectRepos, err := p.getProjectRepos(ctx, organization, project)
+			if err != nil {
+				return nil, err
+			}
+			repos = append(repos, projectRepos...)
+		}
+	}
+	return repos, nil
+}
+
+// Organizations are listed by the member id of the token owner
+func (p *AzureProvider) getOrganizations(ctx context.Context) ([]string, error) {
+	var profile struct {
+		ID string `json:"id"`
+	}
+	_, err := p.get(ctx, p.ProfileAPI+"/profile/profiles/me?api-version="+azureAPIVersion, &profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts AzureAccountList
+	query := url.Values{}
+	query.Set("api-version", azureAPIVersion)
+	query.Set("memberId", profile.ID)
+	_, err = p.get(ctx, p.ProfileAPI+"/accounts?"+query.Encode(), &accounts)
+	if err != nil {
+		return nil, err
+	}
+	organizations := make([]string, 0, len(accounts.Value))
+	for _, account := range accounts.Value {
+		organizations = append(organizations, account.AccountName)
+	}
+	return organizations, nil
+}
+
+// Projects are paginated with continuation tokens, the next token is returned in the x-ms-continuationtoken header
+func (p *AzureProvider) getProjects(ctx context.Context, organization string) ([]azureProject, error) {
+	projects := make([]azureProject, 0)
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("api-version", azureAPIVersion)
+		query.Set("$top", "100")
+		if continuationToken != "" {
+			query.Set("continuationToken", continuationToken)
+		}
+		var page AzureProjectList
+		header, err := p.get(ctx, fmt.Sprintf("%s/%s/_apis/projects?%s", p.BaseURL, url.PathEscape(organization), query.Encode()), &page)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, page.Value...)
+		continuationToken = header.Get("X-Ms-Continuationtoken")
+		if continuationToken == "" {
+			return projects, nil
+		}
+	}
+}
+
+func (p *AzureProvider) getProjectRepos(ctx context.Context, organization string, project azureProject) ([]*entity.Repository, error) {
+	var azureRepos AzureRepositoryList
+	requestURL := fmt.Sprintf("%s/%s/%s/_apis/git/repositories?api-version=%s", p.BaseURL, url.PathEscape(organization), url.PathEscape(project.ID), azureAPIVersion)
+	_, err := p.get(ctx, requestURL, &azureRepos)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]*entity.Repository, 0, len(azureRepos.Value))
+	for _, azureRepo := range azureRepos.Value {
+		// Disabled repositories can't be cloned, empty ones have no default branch
+		if azureRepo.IsDisabled || azureRepo.DefaultBranch == "" {
+			continue
+		}
+		repos = append(repos, &entity.Repository{
+			ID:            azureRepo.ID,
+			FullName:      organization + "/" + project.Name + "/" + azureRepo.Name,
+			Name:          azureRepo.Name,
+			Provider:      p.Name,
+			CloneURL:      removeUserInfo(azureRepo.RemoteURL),
+			SSHURL:        azureRepo.SSHURL,
+			DefaultBranch: strings.TrimPrefix(azureRepo.DefaultBranch, "refs/heads/"),
+		})
+	}
+	return repos, nil
+}
+
+func (p *AzureProvider) get(ctx context.Context, requestURL string, v interface{}) (http.Header, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Personal access tokens are sent as the password of basic auth
+	request.SetBasicAuth("", p.Token)
+	// Otherwise rejected tokens are redirected to the sign-in page instead of returning 401
+	request.Header.Set("X-TFS-FedAuthRedirect", "Suppress")
+	return doRequest(p.Name, p.Client, p.Retry, request, v)
+}
+
+// Remote urls contain the organization as username (https://org@dev.azure.com/org/project/_git/repo),
+// it would be saved to .git/config and used instead of the configured username.
+func removeUserInfo(remoteURL string) string {
+	parsedURL, err := url.Parse(remoteURL)
+	if err != nil {
+		return remoteURL
+	}
+	parsedURL.User = nil
+	return parsedURL.String()
+}
+
+// AzureAccountList response from Azure DevOps accounts API
+type AzureAccountList struct {
+	Value []struct {
+		AccountID   string `json:"accountId"`
+		AccountName string `json:"accountName"`
+	} `json:"value"`
+}
+
+// AzureProjectList response from Azure DevOps projects API
+type AzureProjectList struct {
+	Value []azureProject `json:"value"`
+}
+
+type azureProject struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+}
+
+// AzureRepositoryList response from Azure DevOps git repositories API
+type AzureRepositoryList struct {
+	Value []azureRepository `json:"value"`
+}
+
+type azureRepository struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"defaultBranch"`
+	Size          int64  `json:"size"`
+	RemoteURL     string `json:"remoteUrl"`
+	SSHURL        string `json:"sshUrl"`
+	WebURL        string `json:"webUrl"`
+	IsDisabled    bool   `json:"isDisabled"`
+}
@@ -0,0 +1,112 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+)
+
+var _ = Describe("Azure DevOps", func() {
+
+	azureConfig := config.ProviderConfig{
+		Name:           "dev.azure.com",
+		ProviderName:   "dev.azure.com",
+		Token:          "token",
+		RepoVisibility: "all",
+	}
+	projectsURL := "https://dev.azure.com/fabrikam/_apis/projects?%24top=100&api-version=6.0"
+	fiberReposURL := "https://dev.azure.com/fabrikam/eb6e4656-77fc-42a1-9181-4c6d8e9da5d1/_apis/git/repositories?api-version=6.0"
+	openSourceReposURL := "https://dev.azure.com/fabrikam/eb6e4656-77fc-42a1-9181-4c6d8e9da5d2/_apis/git/repositories?api-version=6.0"
+	toolsReposURL := "https://dev.azure.com/fabrikam/eb6e4656-77fc-42a1-9181-4c6d8e9da5d3/_apis/git/repositories?api-version=6.0"
+
+	registerProjects := func() {
+		firstPage := httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/azure_projects_page_1.json")))
+		firstPage.Header.Set("x-ms-continuationtoken", "2")
+		httpmock.RegisterResponder("GET", projectsURL, httpmock.ResponderFromResponse(firstPage))
+		httpmock.RegisterResponder("GET", "https://dev.azure.com/fabrikam/_apis/projects?%24top=100&api-version=6.0&continuationToken=2", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/azure_projects_page_2.json"))))
+		httpmock.RegisterResponder("GET", fiberReposURL, httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/azure_repositories_fiber.json"))))
+		httpmock.RegisterResponder("GET", openSourceReposURL, httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/azure_repositories_open_source.json"))))
+		httpmock.RegisterResponder("GET", toolsReposURL, httpmock.NewStringResponder(200, `{"count": 0, "value": []}`))
+	}
+
+	Describe("Creating provider", func() {
+		It("should return with correct provider", func() {
+			Expect(newProvider(azureConfig)).To(BeAssignableToTypeOf(&provider.AzureProvider{}))
+		})
+	})
+
+	Describe("Getting repositories", func() {
+		BeforeEach(func() {
+			httpmock.Activate()
+		})
+
+		AfterEach(func() {
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should get the repositories of every organization of the user", func() {
+			httpmock.RegisterResponder("GET", "https://app.vssps.visualstudio.com/_apis/profile/profiles/me?api-version=6.0", func(request *http.Request) (*http.Response, error) {
+				username, password, ok := request.BasicAuth()
+				Expect(ok).To(BeTrue())
+				Expect(username).To(BeEmpty())
+				Expect(password).To(Equal("token"))
+				return httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/azure_profile.json"))), nil
+			})
+			httpmock.RegisterResponder("GET", "https://app.vssps.visualstudio.com/_apis/accounts?api-version=6.0&memberId=5c5e7a8e-4f7c-6b53-9c6f-2f5c8f0e2b1a", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/azure_accounts.json"))))
+			registerProjects()
+
+			repos, err := newProvider(azureConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			// Profile, accounts, 2 pages of projects and the repositories of 3 projects
+			Expect(httpmock.GetTotalCallCount()).To(Equal(7))
+			// Disabled and empty repositories are skipped
+			Expect(len(repos)).To(Equal(2))
+			Expect(repos[0].ID).To(Equal("5febef5a-833d-4e14-b9c0-14cb638f91e1"))
+			Expect(repos[0].FullName).To(Equal("fabrikam/Fabrikam Fiber/fabrikam-web"))
+			Expect(repos[0].Name).To(Equal("fabrikam-web"))
+			Expect(repos[0].Provider).To(Equal("dev.azure.com"))
+			Expect(repos[0].CloneURL).To(Equal("https://dev.azure.com/fabrikam/Fabrikam%20Fiber/_git/fabrikam-web"))
+			Expect(repos[0].SSHURL).To(Equal("git@ssh.dev.azure.com:v3/fabrikam/Fabrikam%20Fiber/fabrikam-web"))
+			Expect(repos[0].DefaultBranch).To(Equal("main"))
+			Expect(repos[1].FullName).To(Equal("fabrikam/Open Source/sdk"))
+			Expect(repos[1].DefaultBranch).To(Equal("master"))
+		})
+
+		It("should only use the configured organizations and projects with the right visibility", func() {
+			publicConfig := azureConfig
+			publicConfig.Organizations = []string{"fabrikam"}
+			publicConfig.RepoVisibility = "public"
+			registerProjects()
+
+			repos, err := newProvider(publicConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(1))
+			Expect(repos[0].FullName).To(Equal("fabrikam/Open Source/sdk"))
+			Expect(httpmock.GetCallCountInfo()["GET "+fiberReposURL]).To(Equal(0))
+			Expect(httpmock.GetCallCountInfo()["GET "+openSourceReposURL]).To(Equal(1))
+		})
+
+		It("should return an error for a rejected token", func() {
+			rejectedConfig := azureConfig
+			rejectedConfig.Organizations = []string{"fabrikam"}
+			httpmock.RegisterResponder("GET", projectsURL, func(request *http.Request) (*http.Response, error) {
+				Expect(request.Header.Get("X-TFS-FedAuthRedirect")).To(Equal("Suppress"))
+				return httpmock.NewStringResponse(401, `{"$id": "1", "innerException": null, "message": "TF400813: The user is not authorized to access this resource.", "typeName": "Microsoft.TeamFoundation.Framework.Server.UnauthorizedRequestException"}`), nil
+			})
+
+			_, err := newProvider(rejectedConfig).GetRepos(context.Background())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.Unauthorized()).To(BeTrue())
+			Expect(apiError.Message).To(Equal("TF400813: The user is not authorized to access this resource."))
+		})
+	})
+
+})
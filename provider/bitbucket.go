@@ -1,96 +1,154 @@
 package provider
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"log"
+	"context"
 	"net/http"
 	"net/url"
 
 	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
 )
 
 // BitbucketProvider Bitbucket provider used for handling Bitbucket API operations
 type BitbucketProvider struct {
+	Name       string
 	Scheme     string
 	BaseURL    string
 	Path       string
 	Username   string
 	Token      string
 	Visibility string
+	Retry      retry.Policy
+	Client     *http.Client
 }
 
 // NewBitbucketProvider constructor
-func NewBitbucketProvider(c config.Config) *BitbucketProvider {
+func NewBitbucketProvider(c config.ProviderConfig) (*BitbucketProvider, error) {
+	client, err := newHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
 	return &BitbucketProvider{
+		Name:       c.Name,
 		Scheme:     "https",
 		BaseURL:    "api.bitbucket.org",
 		Path:       "2.0/repositories",
 		Username:   c.Username,
 		Token:      c.Token,
 		Visibility: c.RepoVisibility,
-	}
+		Retry:      retry.APIPolicy,
+		Client:     client,
+	}, nil
 }
 
 // GetRepos returns list of repositories with given token and visibility from provider
-func (p *BitbucketProvider) GetRepos() []*entity.Repository {
+func (p *BitbucketProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
 	requestURL := url.URL{
 		Scheme: p.Scheme,
 		Host:   p.BaseURL,
 		Path:   p.Path,
 	}
+	requestURL.RawQuery = p.getQuery().Encode()
+
+	repos := make([]*entity.Repository, 0)
+	nextURL := requestURL.String()
+	// Bitbucket paginates the results, follow the "next" links until the last page
+	for nextURL != "" {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, nextURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		request.SetBasicAuth(p.Username, p.Token)
+
+		var bitbucketRepos *BitbucketRepository
+		_, err = doRequest(p.Name, p.Client, p.Retry, request, &bitbucketRepos)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range bitbucketRepos.Values {
+			repos = append(repos, &entity.Repository{
+				ID:            repo.UUID,
+				FullName:      repo.FullName,
+				Name:          repo.Name,
+				Provider:      p.Name,
+				SSHURL:        repo.getCloneLink("ssh"),
+				DefaultBranch: repo.MainBranch.Name,
+			})
+		}
+
+		nextURL, err = p.getNextURL(bitbucketRepos.Next)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	query := requestURL.Query()
+	return repos, nil
+}
+
+func (p *BitbucketProvider) getQuery() url.Values {
+	query := url.Values{}
 	// role is required otherwise we will get all bitbucket repos.
 	query.Set("role", "contributor")
+	// 100 is the maximum page length allowed by the API
+	query.Set("pagelen", "100")
 
 	if p.Visibility == "public" {
 		// By default Bitbucket API returns all repositories
 		query.Set("q", "is_private = false")
 	}
+	return query
+}
 
-	requestURL.RawQuery = query.Encode()
-
-	request, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	request.SetBasicAuth(p.Username, p.Token)
-
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		log.Fatal(err)
+// The "next" link already contains the query of the original request, but make sure
+// role and visibility filters are never lost while paginating.
+func (p *BitbucketProvider) getNextURL(next string) (string, error) {
+	if next == "" {
+		return "", nil
 	}
-
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
-
-	var bitbucketRepos *BitbucketRepository
-	err = json.Unmarshal([]byte(body), &bitbucketRepos)
+	nextURL, err := url.Parse(next)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-
-	repos := make([]*entity.Repository, len(bitbucketRepos.Values))
-	for index, repo := range bitbucketRepos.Values {
-		repos[index] = &entity.Repository{
-			ID:       repo.UUID,
-			FullName: repo.FullName,
-			Name:     repo.Name,
+	query := nextURL.Query()
+	for key, values := range p.getQuery() {
+		if query.Get(key) == "" {
+			query[key] = values
 		}
 	}
-
-	return repos
+	nextURL.RawQuery = query.Encode()
+	return nextURL.String(), nil
 }
 
 // BitbucketRepository response from Bitbucket API
 type BitbucketRepository struct {
-	Values []struct {
-		UUID     string `json:"uuid"`
-		FullName string `json:"full_name"`
-		Name     string `json:"name"`
-	} `json:"values"`
+	Values []bitbucketRepositoryValue `json:"values"`
+	Next   string                     `json:"next"`
+}
+
+type bitbucketRepositoryValue struct {
+	UUID       string `json:"uuid"`
+	FullName   string `json:"full_name"`
+	Name       string `json:"name"`
+	MainBranch struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+	Links struct {
+		Clone []struct {
+			Href string `json:"href"`
+			Name string `json:"name"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// Returns the clone url with the given name (https or ssh)
+func (v *bitbucketRepositoryValue) getCloneLink(name string) string {
+	for _, link := range v.Links.Clone {
+		if link.Name == name {
+			return link.Href
+		}
+	}
+	return ""
 }
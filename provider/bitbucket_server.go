@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+// BitbucketServerProvider used for handling Bitbucket Server and Data Center API operations
+type BitbucketServerProvider struct {
+	Name       string
+	BaseURL    string
+	Token      string
+	Visibility string
+	Retry      retry.Policy
+	Client     *http.Client
+}
+
+// NewBitbucketServerProvider constructor
+func NewBitbucketServerProvider(c config.ProviderConfig) (*BitbucketServerProvider, error) {
+	client, err := newHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &BitbucketServerProvider{
+		Name:       c.Name,
+		BaseURL:    strings.TrimRight(c.BaseURL, "/"),
+		Token:      c.Token,
+		Visibility: c.RepoVisibility,
+		Retry:      retry.APIPolicy,
+		Client:     client,
+	}, nil
+}
+
+// GetRepos returns list of repositories with given token and visibility from provider
+func (p *BitbucketServerProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
+	repos := make([]*entity.Repository, 0)
+	start := 0
+	for {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.getRequestURL(start), nil)
+		if err != nil {
+			return nil, err
+		}
+		// Personal access tokens are sent as bearer tokens
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Token))
+
+		var page BitbucketServerRepositoryPage
+		_, err = doRequest(p.Name, p.Client, p.Retry, request, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, repo := range page.Values {
+			// Older versions ignore the visibility filter of the request
+			if (p.Visibility == "public" && !repo.Public) || (p.Visibility == "private" && repo.Public) {
+				continue
+			}
+			repos = append(repos, &entity.Repository{
+				ID:       strconv.Itoa(repo.ID),
+				FullName: repo.Project.Key + "/" + repo.Slug,
+				Name:     repo.Name,
+				Provider: p.Name,
+				CloneURL: p.getCloneURL(repo),
+				SSHURL:   repo.getCloneLink("ssh"),
+			})
+		}
+
+		if page.IsLastPage || len(page.Values) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+
+	return repos, nil
+}
+
+func (p *BitbucketServerProvider) getRequestURL(start int) string {
+	query := url.Values{}
+	// Only repositories the user can push to, otherwise we would get every repository of the company
+	query.Set("permission", "REPO_WRITE")
+	query.Set("limit", "100")
+	query.Set("start", strconv.Itoa(start))
+	if p.Visibility != "all" {
+		query.Set("visibility", p.Visibility)
+	}
+	return p.BaseURL + "/rest/api/1.0/repos?" + query.Encode()
+}
+
+// Clone urls don't follow the host/FullName pattern: they are under /scm with the lower case project key,
+// and the instance can be served from a sub path (e.g. https://example.com/bitbucket/scm/proj/repo.git).
+func (p *BitbucketServerProvider) getCloneURL(repo bitbucketServerRepository) string {
+	if cloneURL := repo.getCloneLink("http"); cloneURL != "" {
+		return cloneURL
+	}
+	return fmt.Sprintf("%s/scm/%s/%s.git", p.BaseURL, strings.ToLower(repo.Project.Key), repo.Slug)
+}
+
+// BitbucketServerRepositoryPage response from Bitbucket Server API
+type BitbucketServerRepositoryPage struct {
+	Values        []bitbucketServerRepository `json:"values"`
+	IsLastPage    bool                        `json:"isLastPage"`
+	NextPageStart int                         `json:"nextPageStart"`
+}
+
+type bitbucketServerRepository struct {
+	ID      int    `json:"id"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Public  bool   `json:"public"`
+	Project struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	} `json:"project"`
+	Links struct {
+		Clone []struct {
+			Href string `json:"href"`
+			Name string `json:"name"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+// Returns the clone url with the given name (http or ssh)
+func (r *bitbucketServerRepository) getCloneLink(name string) string {
+	for _, link := range r.Links.Clone {
+		if link.Name == name {
+			return link.Href
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+)
+
+var _ = Describe("Bitbucket Server", func() {
+
+	serverConfig := config.ProviderConfig{
+		Name:           "bitbucket-server",
+		ProviderName:   "bitbucket-server",
+		BaseURL:        "https://bitbucket.example.com/bitbucket/",
+		Username:       "jdoe",
+		Token:          "token",
+		RepoVisibility: "all",
+	}
+	firstPageURL := "https://bitbucket.example.com/bitbucket/rest/api/1.0/repos?limit=100&permission=REPO_WRITE&start=0"
+	secondPageURL := "https://bitbucket.example.com/bitbucket/rest/api/1.0/repos?limit=100&permission=REPO_WRITE&start=2"
+
+	Describe("Creating provider", func() {
+		It("should return with correct provider", func() {
+			Expect(newProvider(serverConfig)).To(BeAssignableToTypeOf(&provider.BitbucketServerProvider{}))
+		})
+	})
+
+	Describe("Getting repositories", func() {
+		It("should follow pages until the last one", func() {
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", firstPageURL, httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_server_page_1.json"))))
+			httpmock.RegisterResponder("GET", secondPageURL, httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_server_page_2.json"))))
+			repos, err := newProvider(serverConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+			Expect(len(repos)).To(Equal(3))
+			Expect(repos[0].ID).To(Equal("1"))
+			Expect(repos[0].FullName).To(Equal("PLAT/billing-api"))
+			Expect(repos[0].Name).To(Equal("Billing API"))
+			Expect(repos[0].Provider).To(Equal("bitbucket-server"))
+			Expect(repos[0].CloneURL).To(Equal("https://jdoe@bitbucket.example.com/bitbucket/scm/plat/billing-api.git"))
+			Expect(repos[0].SSHURL).To(Equal("ssh://git@bitbucket.example.com:7999/plat/billing-api.git"))
+			// Clone url is built from the project key and slug when the links are missing
+			Expect(repos[2].CloneURL).To(Equal("https://bitbucket.example.com/bitbucket/scm/ops/deploy-scripts.git"))
+			Expect(repos[2].UniqueID()).To(Equal("bitbucket-server-3"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should filter repositories by visibility", func() {
+			privateConfig := serverConfig
+			privateConfig.RepoVisibility = "private"
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", "https://bitbucket.example.com/bitbucket/rest/api/1.0/repos?limit=100&permission=REPO_WRITE&start=0&visibility=private", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_server_page_1.json"))))
+			httpmock.RegisterResponder("GET", "https://bitbucket.example.com/bitbucket/rest/api/1.0/repos?limit=100&permission=REPO_WRITE&start=2&visibility=private", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_server_page_2.json"))))
+			repos, err := newProvider(privateConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(2))
+			Expect(repos[0].FullName).To(Equal("PLAT/billing-api"))
+			Expect(repos[1].FullName).To(Equal("OPS/deploy-scripts"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should send the personal access token and return the API error message", func() {
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", firstPageURL, func(request *http.Request) (*http.Response, error) {
+				Expect(request.Header.Get("Authorization")).To(Equal("Bearer token"))
+				return httpmock.NewStringResponse(401, `{"errors": [{"context": null, "message": "Authentication failed. Please check your credentials and try again.", "exceptionName": "com.atlassian.bitbucket.auth.IncorrectPasswordAuthenticationException"}]}`), nil
+			})
+			_, err := newProvider(serverConfig).GetRepos(context.Background())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.Unauthorized()).To(BeTrue())
+			Expect(apiError.Message).To(Equal("Authentication failed. Please check your credentials and try again."))
+			httpmock.DeactivateAndReset()
+		})
+	})
+
+})
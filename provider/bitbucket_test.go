@@ -1,6 +1,9 @@
 package provider_test
 
 import (
+	"context"
+	"errors"
+
 	"github.com/jarcoal/httpmock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -11,7 +14,8 @@ import (
 
 var _ = Describe("Bitbucket", func() {
 
-	p := provider.NewProvider(config.Config{
+	p := newProvider(config.ProviderConfig{
+		Name:           "bitbucket.org",
 		ProviderName:   "bitbucket.org",
 		Token:          "token",
 		RepoVisibility: "public",
@@ -26,12 +30,29 @@ var _ = Describe("Bitbucket", func() {
 	Describe("Getting repositories", func() {
 		It("should get repositories of the user", func() {
 			httpmock.Activate()
-			httpmock.RegisterResponder("GET", "https://api.bitbucket.org/2.0/repositories?q=is_private+%3D+false&role=contributor", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_public.json"))))
-			repos := p.GetRepos()
-			Expect(len(repos)).To(Equal(10))
+			httpmock.RegisterResponder("GET", "https://api.bitbucket.org/2.0/repositories?pagelen=100&q=is_private+%3D+false&role=contributor", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_public.json"))))
+			httpmock.RegisterResponder("GET", "https://api.bitbucket.org/2.0/repositories?after=2011-09-03T12%3A33%3A16.028393%2B00%3A00&pagelen=100&q=is_private+%3D+false&role=contributor", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/bitbucket_public_page_2.json"))))
+			repos, err := p.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(13))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
 			Expect(repos[0].FullName).To(Equal("opensymphony/xwork"))
 			Expect(repos[0].Name).To(Equal("xwork"))
 			Expect(repos[0].ID).To(Equal("{3f630668-75f1-4903-ae5e-8ea37437e09e}"))
+			Expect(repos[0].SSHURL).To(Equal("git@bitbucket.org:opensymphony/xwork.git"))
+			Expect(repos[0].DefaultBranch).To(Equal("master"))
+			Expect(repos[12].FullName).To(Equal("opensymphony/osworkflow"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should return the API error message", func() {
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", "https://api.bitbucket.org/2.0/repositories?pagelen=100&q=is_private+%3D+false&role=contributor", httpmock.NewStringResponder(403, `{"type": "error", "error": {"message": "Access denied. You must have write or admin access."}}`))
+			_, err := p.GetRepos(context.Background())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.Message).To(Equal("Access denied. You must have write or admin access."))
+			Expect(apiError.RateLimited).To(BeFalse())
 			httpmock.DeactivateAndReset()
 		})
 	})
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+// APIError is returned when a provider API responds with a non 2xx status code
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	// RateLimited is set when the provider refused the request because of rate limiting
+	RateLimited bool
+	// RetryAfter is how long the provider asked to wait before the next request, 0 if it didn't tell
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("%s returned %d %s", e.Provider, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.RateLimited {
+		message += " (rate limit exceeded)"
+	}
+	if e.Message != "" {
+		message += ": " + e.Message
+	}
+	return message
+}
+
+// Unauthorized reports whether the credentials were rejected by the provider
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// Temporary reports whether the same request can succeed later
+func (e *APIError) Temporary() bool {
+	return e.RateLimited || retry.TemporaryStatus(e.StatusCode)
+}
+
+func newAPIError(providerName string, response *http.Response, body []byte) *APIError {
+	apiError := &APIError{
+		Provider:   providerName,
+		StatusCode: response.StatusCode,
+		Message:    getErrorMessage(body),
+	}
+	if response.StatusCode == http.StatusTooManyRequests ||
+		(response.StatusCode == http.StatusForbidden && response.Header.Get("X-RateLimit-Remaining") == "0") {
+		apiError.RateLimited = true
+	}
+	now := time.Now()
+	apiError.RetryAfter = retry.ParseRetryAfter(response.Header.Get("Retry-After"), now)
+	if apiError.RetryAfter == 0 && apiError.RateLimited {
+		// GitHub and GitLab tell when the rate limit resets as a unix timestamp
+		if reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil && reset > now.Unix() {
+			apiError.RetryAfter = time.Unix(reset, 0).Sub(now)
+		}
+	}
+	return apiError
+}
+
+// Providers use different error formats, try the known ones before falling back to the raw body
+func getErrorMessage(body []byte) string {
+	var errorBody struct {
+		Message json.RawMessage `json:"message"`
+		Error   json.RawMessage `json:"error"`
+		// Bitbucket Server returns a list of errors
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &errorBody); err == nil {
+		for _, raw := range []json.RawMessage{errorBody.Message, errorBody.Error} {
+			if message := getMessageFromJSON(raw); message != "" {
+				return message
+			}
+		}
+		if len(errorBody.Errors) > 0 && errorBody.Errors[0].Message != "" {
+			return errorBody.Errors[0].Message
+		}
+	}
+	message := strings.TrimSpace(string(body))
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+	return message
+}
+
+// Message can be a string ({"message": "Bad credentials"}) or an object ({"error": {"message": "..."}})
+func getMessageFromJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return message
+	}
+	var nested struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &nested); err == nil {
+		return nested.Message
+	}
+	return ""
+}
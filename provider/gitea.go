@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+// GiteaProvider used for handling Gitea and Forgejo API operations
+type GiteaProvider struct {
+	Name       string
+	GiteaAPI   string
+	Token      string
+	Visibility string
+	Retry      retry.Policy
+	Client     *http.Client
+}
+
+// NewGiteaProvider constructor
+func NewGiteaProvider(c config.ProviderConfig) (*GiteaProvider, error) {
+	client, err := newHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &GiteaProvider{
+		Name:       c.Name,
+		GiteaAPI:   strings.TrimRight(c.BaseURL, "/") + "/api/v1/user/repos",
+		Token:      c.Token,
+		Visibility: c.RepoVisibility,
+		Retry:      retry.APIPolicy,
+		Client:     client,
+	}, nil
+}
+
+// GetRepos returns list of repositories with given token and visibility from provider
+func (p *GiteaProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
+	repos := make([]*entity.Repository, 0)
+	// 50 is the default maximum page size of Gitea
+	requestURL := p.GiteaAPI + "?limit=50&page=1"
+	// Gitea paginates the results like GitHub, follow the "next" links until the last page
+	for requestURL != "" {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", fmt.Sprintf("token %s", p.Token))
+
+		var giteaRepos []*GiteaRepository
+		header, err := doRequest(p.Name, p.Client, p.Retry, request, &giteaRepos)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, giteaRepo := range giteaRepos {
+			// Internal repositories are not public, so they are listed as private ones
+			private := giteaRepo.Private || giteaRepo.Internal
+			if (p.Visibility == "public" && private) || (p.Visibility == "private" && !private) {
+				continue
+			}
+			// Empty repositories can't be cloned
+			if giteaRepo.Empty {
+				continue
+			}
+			repos = append(repos, &entity.Repository{
+				ID:            strconv.Itoa(giteaRepo.ID),
+				FullName:      giteaRepo.FullName,
+				Name:          giteaRepo.Name,
+				Provider:      p.Name,
+				CloneURL:      giteaRepo.CloneURL,
+				SSHURL:        giteaRepo.SSHURL,
+				DefaultBranch: giteaRepo.DefaultBranch,
+			})
+		}
+
+		requestURL = getNextPageURL(header)
+	}
+
+	return repos, nil
+}
+
+// GiteaRepository response from Gitea API
+type GiteaRepository struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	Owner    struct {
+		ID    int    `json:"id"`
+		Login string `json:"login"`
+	} `json:"owner"`
+	Private       bool   `json:"private"`
+	Internal      bool   `json:"internal"`
+	Fork          bool   `json:"fork"`
+	Mirror        bool   `json:"mirror"`
+	Empty         bool   `json:"empty"`
+	HTMLURL       string `json:"html_url"`
+	CloneURL      string `json:"clone_url"`
+	SSHURL        string `json:"ssh_url"`
+	DefaultBranch string `json:"default_branch"`
+}
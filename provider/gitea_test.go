@@ -0,0 +1,134 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+)
+
+// Stand-in for the repository API of a Gitea instance
+type fakeGitea struct {
+	Token    string
+	Repos    []provider.GiteaRepository
+	Requests int
+}
+
+func (g *fakeGitea) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.Requests++
+	if r.URL.Path != "/api/v1/user/repos" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "token "+g.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "token is required", "url": "https://gitea.example.com/api/swagger"}`))
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	start := (page - 1) * limit
+	end := start + limit
+	if end > len(g.Repos) {
+		end = len(g.Repos)
+	}
+	if end < len(g.Repos) {
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/v1/user/repos?limit=%d&page=%d>; rel="next"`, r.Host, limit, page+1))
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(g.Repos)))
+	json.NewEncoder(w).Encode(g.Repos[start:end])
+}
+
+var _ = Describe("Gitea", func() {
+
+	var gitea *fakeGitea
+	var server *httptest.Server
+	var giteaConfig config.ProviderConfig
+
+	BeforeEach(func() {
+		gitea = &fakeGitea{Token: "token"}
+		for i := 1; i <= 60; i++ {
+			repo := provider.GiteaRepository{
+				ID:            i,
+				Name:          fmt.Sprintf("repo-%d", i),
+				FullName:      fmt.Sprintf("me/repo-%d", i),
+				Private:       i%3 == 0,
+				Internal:      i == 10,
+				Empty:         i == 60,
+				CloneURL:      fmt.Sprintf("https://gitea.example.com/me/repo-%d.git", i),
+				SSHURL:        fmt.Sprintf("git@gitea.example.com:me/repo-%d.git", i),
+				DefaultBranch: "main",
+			}
+			gitea.Repos = append(gitea.Repos, repo)
+		}
+		server = httptest.NewServer(gitea)
+		giteaConfig = config.ProviderConfig{
+			Name:           "gitea.example.com",
+			ProviderName:   "gitea",
+			BaseURL:        server.URL + "/",
+			Token:          "token",
+			RepoVisibility: "all",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Creating provider", func() {
+		It("should return with correct provider", func() {
+			Expect(newProvider(giteaConfig)).To(BeAssignableToTypeOf(&provider.GiteaProvider{}))
+		})
+	})
+
+	Describe("Getting repositories", func() {
+		It("should follow the pages and skip empty repositories", func() {
+			repos, err := newProvider(giteaConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gitea.Requests).To(Equal(2))
+			Expect(len(repos)).To(Equal(59))
+			Expect(repos[0].ID).To(Equal("1"))
+			Expect(repos[0].FullName).To(Equal("me/repo-1"))
+			Expect(repos[0].Name).To(Equal("repo-1"))
+			Expect(repos[0].Provider).To(Equal("gitea.example.com"))
+			Expect(repos[0].CloneURL).To(Equal("https://gitea.example.com/me/repo-1.git"))
+			Expect(repos[0].SSHURL).To(Equal("git@gitea.example.com:me/repo-1.git"))
+			Expect(repos[0].DefaultBranch).To(Equal("main"))
+			Expect(repos[58].UniqueID()).To(Equal("gitea.example.com-59"))
+		})
+
+		It("should list internal repositories as private ones", func() {
+			giteaConfig.RepoVisibility = "private"
+			repos, err := newProvider(giteaConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(20))
+			Expect(repos[2].FullName).To(Equal("me/repo-9"))
+			Expect(repos[3].FullName).To(Equal("me/repo-10"))
+
+			giteaConfig.RepoVisibility = "public"
+			repos, err = newProvider(giteaConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(39))
+		})
+
+		It("should return an error for a bad token", func() {
+			giteaConfig.Token = "other"
+			_, err := newProvider(giteaConfig).GetRepos(context.Background())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.Unauthorized()).To(BeTrue())
+			Expect(apiError.Message).To(Equal("token is required"))
+			Expect(gitea.Requests).To(Equal(1))
+		})
+	})
+
+})
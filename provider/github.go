@@ -1,67 +1,98 @@
 package provider
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
 )
 
 // GithubProvider used for handling github related operations
 type GithubProvider struct {
+	Name       string
 	GithubAPI  string
 	Token      string
 	Visibility string
+	Retry      retry.Policy
+	Client     *http.Client
 }
 
-// NewGithubProvider constructor
-func NewGithubProvider(c config.Config) *GithubProvider {
+// NewGithubProvider constructor, BaseURL is set for GitHub Enterprise Server
+func NewGithubProvider(c config.ProviderConfig) (*GithubProvider, error) {
+	apiURL := "https://api.github.com"
+	if c.BaseURL != "" {
+		// GitHub Enterprise Server serves the REST API under /api/v3
+		apiURL = strings.TrimSuffix(strings.TrimRight(c.BaseURL, "/"), "/api/v3") + "/api/v3"
+	}
+	client, err := newHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
 	return &GithubProvider{
-		GithubAPI:  "https://api.github.com/user/repos",
+		Name:       c.Name,
+		GithubAPI:  apiURL + "/user/repos",
 		Token:      c.Token,
 		Visibility: c.RepoVisibility,
-	}
+		Retry:      retry.APIPolicy,
+		Client:     client,
+	}, nil
 }
 
 // GetRepos returns list of repositories with given token and visibility from provider
-func (p *GithubProvider) GetRepos() []*entity.Repository {
-	requestURL := fmt.Sprintf("%s?visibility=%s", p.GithubAPI, p.Visibility)
-	request, err := http.NewRequest(http.MethodGet, requestURL, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Token))
+func (p *GithubProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
+	repos := make([]*entity.Repository, 0)
+	requestURL := fmt.Sprintf("%s?per_page=100&visibility=%s", p.GithubAPI, p.Visibility)
+	// GitHub paginates the results, follow the "next" links until the last page
+	for requestURL != "" {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Token))
 
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer response.Body.Close()
-	body, err := ioutil.ReadAll(response.Body)
+		var githubRepos []*GithubRepository
+		header, err := doRequest(p.Name, p.Client, p.Retry, request, &githubRepos)
+		if err != nil {
+			return nil, err
+		}
 
-	var githubRepos []*GithubRepository
-	err = json.Unmarshal([]byte(body), &githubRepos)
-	if err != nil {
-		log.Fatal(err)
+		for _, githubRepo := range githubRepos {
+			repos = append(repos, &entity.Repository{
+				ID:            strconv.Itoa(githubRepo.ID),
+				FullName:      githubRepo.FullName,
+				Name:          githubRepo.Name,
+				Provider:      p.Name,
+				CloneURL:      githubRepo.CloneURL,
+				SSHURL:        githubRepo.SSHURL,
+				DefaultBranch: githubRepo.DefaultBranch,
+			})
+		}
+
+		requestURL = getNextPageURL(header)
 	}
 
-	repos := make([]*entity.Repository, len(githubRepos))
-	for i, githubRepo := range githubRepos {
-		repos[i] = &entity.Repository{
-			ID:       strconv.Itoa(githubRepo.ID),
-			FullName: githubRepo.FullName,
-			Name:     githubRepo.Name,
+	return repos, nil
+}
+
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="next"`)
+
+// getNextPageURL returns the url marked with rel="next" in the Link header (RFC 8288).
+// Returns empty string if there are no more pages.
+func getNextPageURL(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		matches := linkNextRegex.FindStringSubmatch(link)
+		if len(matches) == 2 {
+			return matches[1]
 		}
 	}
-
-	return repos
+	return ""
 }
 
 // GithubRepository response from github api
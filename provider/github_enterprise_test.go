@@ -0,0 +1,105 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+var _ = Describe("GitHub Enterprise", func() {
+
+	enterpriseConfig := config.ProviderConfig{
+		Name:           "github.example.com",
+		ProviderName:   "github.com",
+		BaseURL:        "https://github.example.com/",
+		Token:          "token",
+		RepoVisibility: "public",
+	}
+
+	Describe("Creating provider", func() {
+		It("should use the REST API of the instance", func() {
+			p, err := provider.NewGithubProvider(enterpriseConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.GithubAPI).To(Equal("https://github.example.com/api/v3/user/repos"))
+
+			apiConfig := enterpriseConfig
+			apiConfig.BaseURL = "https://github.example.com/api/v3"
+			p, err = provider.NewGithubProvider(apiConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.GithubAPI).To(Equal("https://github.example.com/api/v3/user/repos"))
+		})
+	})
+
+	Describe("Getting repositories", func() {
+		It("should get repositories from the enterprise host", func() {
+			p := newProvider(enterpriseConfig)
+			httpmock.Activate()
+			firstPage := httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/github_enterprise_page_1.json")))
+			firstPage.Header.Set("Link", `<https://github.example.com/api/v3/user/repos?page=2&per_page=100&visibility=public>; rel="next"`)
+			httpmock.RegisterResponder("GET", "https://github.example.com/api/v3/user/repos?per_page=100&visibility=public", httpmock.ResponderFromResponse(firstPage))
+			httpmock.RegisterResponder("GET", "https://github.example.com/api/v3/user/repos?page=2&per_page=100&visibility=public", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/github_enterprise_page_2.json"))))
+			repos, err := p.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+			Expect(len(repos)).To(Equal(3))
+			Expect(repos[0].FullName).To(Equal("platform/api"))
+			Expect(repos[0].Provider).To(Equal("github.example.com"))
+			Expect(repos[0].CloneURL).To(Equal("https://github.example.com/platform/api.git"))
+			Expect(repos[0].SSHURL).To(Equal("git@github.example.com:platform/api.git"))
+			Expect(repos[2].UniqueID()).To(Equal("github.example.com-12"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should trust the CA bundle of the instance", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.URL.Path).To(Equal("/api/v3/user/repos"))
+				w.Write(getResponseFromFile("../test_fixtures/provider/github_enterprise_page_2.json"))
+			}))
+			defer server.Close()
+
+			caPath, err := ioutil.TempDir("", "github_enterprise_test")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(caPath)
+			caCert := filepath.Join(caPath, "ca.pem")
+			Expect(ioutil.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)).To(Succeed())
+
+			withoutCA := enterpriseConfig
+			withoutCA.BaseURL = server.URL
+			untrusted, err := provider.NewGithubProvider(withoutCA)
+			Expect(err).NotTo(HaveOccurred())
+			untrusted.Retry = retry.Policy{MaxAttempts: 3}
+			_, err = untrusted.GetRepos(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("certificate")))
+
+			withCA := withoutCA
+			withCA.CACert = caCert
+			trusted, err := provider.NewGithubProvider(withCA)
+			Expect(err).NotTo(HaveOccurred())
+			repos, err := trusted.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(1))
+		})
+
+		It("should return an error for a missing CA bundle", func() {
+			withMissingCA := enterpriseConfig
+			withMissingCA.CACert = filepath.Join(os.TempDir(), "missing_ca.pem")
+			_, err := provider.NewGithubProvider(withMissingCA)
+			Expect(err).To(MatchError(ContainSubstring("CA bundle")))
+			_, err = provider.NewProvider(withMissingCA)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+})
@@ -1,8 +1,13 @@
 package provider_test
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 	. "github.com/onsi/ginkgo"
@@ -10,11 +15,13 @@ import (
 
 	"github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
 )
 
 var _ = Describe("Providers", func() {
 
-	p := provider.NewProvider(config.Config{
+	p := newProvider(config.ProviderConfig{
+		Name:           "github.com",
 		ProviderName:   "github.com",
 		Token:          "token",
 		RepoVisibility: "public",
@@ -24,23 +31,164 @@ var _ = Describe("Providers", func() {
 		It("should return with correct provider", func() {
 			Expect(p).NotTo(BeNil())
 		})
+
+		It("should return an error for an unknown provider", func() {
+			_, err := provider.NewProvider(config.ProviderConfig{Name: "github", ProviderName: "github"})
+			Expect(err).To(HaveOccurred())
+		})
 	})
 
 	Describe("Getting repositories", func() {
 		It("should get repositories of the user", func() {
 			httpmock.Activate()
-			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?visibility=public", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/github_public.json"))))
-			repos := p.GetRepos()
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/github_public.json"))))
+			repos, err := p.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
 			Expect(len(repos)).To(Equal(20))
 			Expect(repos[0].FullName).To(Equal("alimgiray/bdd"))
 			Expect(repos[0].Name).To(Equal("bdd"))
 			Expect(repos[0].ID).To(Equal("134240628"))
+			Expect(repos[0].SSHURL).To(Equal("git@github.com:alimgiray/bdd.git"))
+			Expect(repos[0].DefaultBranch).To(Equal("master"))
+			Expect(repos[0].Provider).To(Equal("github.com"))
+			Expect(repos[0].UniqueID()).To(Equal("github.com-134240628"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should follow the next links until the last page", func() {
+			httpmock.Activate()
+			firstPage := httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/github_public_page_1.json")))
+			firstPage.Header.Set("Link", `<https://api.github.com/user/repos?page=2&per_page=100&visibility=public>; rel="next", <https://api.github.com/user/repos?page=2&per_page=100&visibility=public>; rel="last"`)
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", httpmock.ResponderFromResponse(firstPage))
+			secondPage := httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/github_public_page_2.json")))
+			secondPage.Header.Set("Link", `<https://api.github.com/user/repos?page=1&per_page=100&visibility=public>; rel="prev", <https://api.github.com/user/repos?page=1&per_page=100&visibility=public>; rel="first"`)
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?page=2&per_page=100&visibility=public", httpmock.ResponderFromResponse(secondPage))
+			repos, err := p.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(20))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+			Expect(repos[0].FullName).To(Equal("alimgiray/bdd"))
+			Expect(repos[12].FullName).To(Equal("codersrank-org/multi_repo_repo_extractor"))
+			Expect(repos[19].ID).To(Equal("161197542"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should return an error for bad credentials", func() {
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", httpmock.NewStringResponder(401, `{"message": "Bad credentials", "documentation_url": "https://docs.github.com/rest"}`))
+			repos, err := p.GetRepos(context.Background())
+			Expect(repos).To(BeNil())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.Unauthorized()).To(BeTrue())
+			Expect(apiError.Message).To(Equal("Bad credentials"))
+			Expect(err.Error()).To(Equal("github.com returned 401 Unauthorized: Bad credentials"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should return an error when rate limited until later than the retries can wait", func() {
+			httpmock.Activate()
+			response := httpmock.NewStringResponse(403, `{"message": "API rate limit exceeded for user ID 1."}`)
+			response.Header.Set("X-RateLimit-Remaining", "0")
+			response.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", httpmock.ResponderFromResponse(response))
+			_, err := p.GetRepos(context.Background())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.StatusCode).To(Equal(403))
+			Expect(apiError.RateLimited).To(BeTrue())
+			Expect(apiError.RetryAfter).To(BeNumerically(">", 59*time.Minute))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
 			httpmock.DeactivateAndReset()
 		})
 	})
 
+	Describe("Retrying requests", func() {
+		var retrying *provider.GithubProvider
+
+		BeforeEach(func() {
+			var err error
+			retrying, err = provider.NewGithubProvider(config.ProviderConfig{
+				Name:           "github.com",
+				ProviderName:   "github.com",
+				Token:          "token",
+				RepoVisibility: "public",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			retrying.Retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Second}
+			httpmock.Activate()
+		})
+
+		AfterEach(func() {
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should retry temporary errors until the request succeeds", func() {
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", failingResponder(2, 502, "../test_fixtures/provider/github_public.json"))
+			repos, err := retrying.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(20))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(3))
+		})
+
+		It("should give up after the last attempt", func() {
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", httpmock.NewStringResponder(503, "Service Unavailable"))
+			_, err := retrying.GetRepos(context.Background())
+			var apiError *provider.APIError
+			Expect(errors.As(err, &apiError)).To(BeTrue())
+			Expect(apiError.StatusCode).To(Equal(503))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(3))
+		})
+
+		It("should wait as long as Retry-After asks", func() {
+			response := httpmock.NewStringResponse(429, `{"message": "Too many requests"}`)
+			response.Header.Set("Retry-After", "1")
+			attempts := 0
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", func(request *http.Request) (*http.Response, error) {
+				attempts++
+				if attempts == 1 {
+					return response, nil
+				}
+				return httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/github_public.json"))), nil
+			})
+			start := time.Now()
+			_, err := retrying.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+		})
+
+		It("should not retry bad credentials", func() {
+			httpmock.RegisterResponder("GET", "https://api.github.com/user/repos?per_page=100&visibility=public", httpmock.NewStringResponder(401, `{"message": "Bad credentials"}`))
+			_, err := retrying.GetRepos(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		})
+	})
+
 })
 
+// Providers of the tests are always known
+func newProvider(c config.ProviderConfig) provider.Provider {
+	p, err := provider.NewProvider(c)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Responds with the status code the given number of times, then with the content of the file
+func failingResponder(failures, statusCode int, filePath string) httpmock.Responder {
+	attempts := 0
+	return func(request *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts <= failures {
+			return httpmock.NewStringResponse(statusCode, http.StatusText(statusCode)), nil
+		}
+		return httpmock.NewStringResponse(200, string(getResponseFromFile(filePath))), nil
+	}
+}
+
 func getResponseFromFile(filePath string) []byte {
 	responseFile, err := os.Open(filePath)
 	if err != nil {
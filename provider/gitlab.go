@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+// GitlabProvider used for handling GitLab (gitlab.com and self-managed) API operations
+type GitlabProvider struct {
+	Name       string
+	GitlabAPI  string
+	Token      string
+	Visibility string
+	Retry      retry.Policy
+	Client     *http.Client
+}
+
+// NewGitlabProvider constructor
+func NewGitlabProvider(c config.ProviderConfig) (*GitlabProvider, error) {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	client, err := newHTTPClient(c)
+	if err != nil {
+		return nil, err
+	}
+	return &GitlabProvider{
+		Name:       c.Name,
+		GitlabAPI:  strings.TrimRight(baseURL, "/") + "/api/v4/projects",
+		Token:      c.Token,
+		Visibility: c.RepoVisibility,
+		Retry:      retry.APIPolicy,
+		Client:     client,
+	}, nil
+}
+
+// GetRepos returns list of repositories with given token and visibility from provider
+func (p *GitlabProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
+	repos := make([]*entity.Repository, 0)
+	page := "1"
+	for page != "" {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.getRequestURL(page), nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.Token))
+
+		var gitlabRepos []*GitlabRepository
+		header, err := doRequest(p.Name, p.Client, p.Retry, request, &gitlabRepos)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, gitlabRepo := range gitlabRepos {
+			// Internal projects are not public, so they are listed as private ones
+			if p.Visibility == "private" && gitlabRepo.Visibility == "public" {
+				continue
+			}
+			repos = append(repos, &entity.Repository{
+				ID:            strconv.Itoa(gitlabRepo.ID),
+				FullName:      gitlabRepo.PathWithNamespace,
+				Name:          gitlabRepo.Path,
+				Provider:      p.Name,
+				CloneURL:      gitlabRepo.HTTPURLToRepo,
+				SSHURL:        gitlabRepo.SSHURLToRepo,
+				DefaultBranch: gitlabRepo.DefaultBranch,
+			})
+		}
+
+		// GitLab sets X-Next-Page to an empty string on the last page
+		page = header.Get("X-Next-Page")
+	}
+
+	return repos, nil
+}
+
+func (p *GitlabProvider) getRequestURL(page string) string {
+	query := url.Values{}
+	// Only projects the user is a member of, otherwise we would get every public project
+	query.Set("membership", "true")
+	query.Set("per_page", "100")
+	query.Set("page", page)
+	if p.Visibility == "public" {
+		query.Set("visibility", "public")
+	}
+	return p.GitlabAPI + "?" + query.Encode()
+}
+
+// GitlabRepository response from GitLab API
+type GitlabRepository struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Path              string `json:"path"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	Visibility        string `json:"visibility"`
+	DefaultBranch     string `json:"default_branch"`
+	HTTPURLToRepo     string `json:"http_url_to_repo"`
+	SSHURLToRepo      string `json:"ssh_url_to_repo"`
+	WebURL            string `json:"web_url"`
+}
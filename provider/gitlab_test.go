@@ -0,0 +1,85 @@
+package provider_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+var _ = Describe("Gitlab", func() {
+
+	p := newProvider(config.ProviderConfig{
+		Name:           "gitlab.com",
+		ProviderName:   "gitlab.com",
+		Token:          "token",
+		RepoVisibility: "public",
+	})
+
+	Describe("Creating provider", func() {
+		It("should return with correct provider", func() {
+			Expect(p).NotTo(BeNil())
+		})
+	})
+
+	Describe("Getting repositories", func() {
+		It("should get repositories of the user", func() {
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", "https://gitlab.com/api/v4/projects?membership=true&page=1&per_page=100&visibility=public", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/gitlab_public.json"))))
+			repos, err := p.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(4))
+			Expect(repos[0].FullName).To(Equal("gitlab-org/gitlab"))
+			Expect(repos[0].Name).To(Equal("gitlab"))
+			Expect(repos[0].ID).To(Equal("278964"))
+			Expect(repos[0].SSHURL).To(Equal("git@gitlab.com:gitlab-org/gitlab.git"))
+			Expect(repos[0].CloneURL).To(Equal("https://gitlab.com/gitlab-org/gitlab.git"))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should follow pages of a self-managed instance", func() {
+			selfManaged := newProvider(config.ProviderConfig{
+				Name:           "gitlab.example.com",
+				ProviderName:   "gitlab.com",
+				BaseURL:        "https://gitlab.example.com/",
+				Token:          "token",
+				RepoVisibility: "all",
+			})
+			httpmock.Activate()
+			firstPage := httpmock.NewStringResponse(200, string(getResponseFromFile("../test_fixtures/provider/gitlab_public.json")))
+			firstPage.Header.Set("X-Next-Page", "2")
+			httpmock.RegisterResponder("GET", "https://gitlab.example.com/api/v4/projects?membership=true&page=1&per_page=100", httpmock.ResponderFromResponse(firstPage))
+			httpmock.RegisterResponder("GET", "https://gitlab.example.com/api/v4/projects?membership=true&page=2&per_page=100", httpmock.NewStringResponder(200, string(getResponseFromFile("../test_fixtures/provider/gitlab_public.json"))))
+			repos, err := selfManaged.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(8))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+			httpmock.DeactivateAndReset()
+		})
+
+		It("should retry a page which failed temporarily", func() {
+			retrying, err := provider.NewGitlabProvider(config.ProviderConfig{
+				Name:           "gitlab.com",
+				ProviderName:   "gitlab.com",
+				Token:          "token",
+				RepoVisibility: "public",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			retrying.Retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Second}
+			httpmock.Activate()
+			httpmock.RegisterResponder("GET", "https://gitlab.com/api/v4/projects?membership=true&page=1&per_page=100&visibility=public", failingResponder(2, 500, "../test_fixtures/provider/gitlab_public.json"))
+			repos, err := retrying.GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(repos)).To(Equal(4))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(3))
+			httpmock.DeactivateAndReset()
+		})
+	})
+
+})
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+
+	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+)
+
+const defaultScanDepth = 3
+
+// LocalProvider finds repositories which are already on disk
+type LocalProvider struct {
+	Name  string
+	Paths []string
+	// MaxDepth is how many folder levels below Paths are scanned
+	MaxDepth int
+}
+
+// NewLocalProvider constructor
+func NewLocalProvider(c config.ProviderConfig) *LocalProvider {
+	maxDepth := c.ScanDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultScanDepth
+	}
+	return &LocalProvider{
+		Name:     c.Name,
+		Paths:    c.Paths,
+		MaxDepth: maxDepth,
+	}
+}
+
+// GetRepos returns the git repositories found in the folders.
+// Repositories are not scanned for nested repositories (e.g. submodules).
+func (p *LocalProvider) GetRepos(ctx context.Context) ([]*entity.Repository, error) {
+	repos := make([]*entity.Repository, 0)
+	// The same repository can be found more than once, e.g. two clones of the same remote
+	found := make(map[string]bool)
+	for _, root := range p.Paths {
+		root, err := filepath.Abs(root)
+		if err == nil {
+			// Walk doesn't follow symlinks, not even the root
+			root, err = filepath.EvalSymlinks(root)
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				// Unreadable folders are skipped, only a missing root is an error
+				if path == root {
+					return err
+				}
+				return nil
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			// Hidden folders (e.g. .cache, .local) are full of clones of tools
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+				repo, err := p.getRepository(root, path)
+				if err != nil {
+					return err
+				}
+				if !found[repo.ID] {
+					found[repo.ID] = true
+					repos = append(repos, repo)
+				}
+				return filepath.SkipDir
+			}
+			if getDepth(root, path) >= p.MaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repos, nil
+}
+
+// IDs are derived from the origin remote, so they don't change when the repository is moved.
+// Repositories without a remote are identified by their path.
+func (p *LocalProvider) getRepository(root, path string) (*entity.Repository, error) {
+	repository, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	identity := path
+	if remote, err := repository.Remote("origin"); err == nil && len(remote.Config().URLs) > 0 {
+		identity = normalizeRemoteURL(remote.Config().URLs[0])
+	}
+	defaultBranch := ""
+	if head, err := repository.Head(); err == nil && head.Name().IsBranch() {
+		defaultBranch = head.Name().Short()
+	}
+	// Named relative to the parent of the scanned folder, so the scanned folder itself gets a name too
+	fullName, err := filepath.Rel(filepath.Dir(root), path)
+	if err != nil {
+		return nil, err
+	}
+	hash := md5.Sum([]byte(identity))
+	return &entity.Repository{
+		ID:            hex.EncodeToString(hash[:]),
+		FullName:      filepath.ToSlash(fullName),
+		Name:          filepath.Base(path),
+		Provider:      p.Name,
+		DefaultBranch: defaultBranch,
+		LocalPath:     path,
+	}, nil
+}
+
+func getDepth(root, path string) int {
+	relativePath, err := filepath.Rel(root, path)
+	if err != nil || relativePath == "." {
+		return 0
+	}
+	return strings.Count(relativePath, string(filepath.Separator)) + 1
+}
+
+var scpLikeURLRegex = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// HTTPS, SSH and scp-like urls of the same repository give the same result
+// (e.g. https://user@github.com/me/repo.git and git@github.com:me/repo are both github.com/me/repo)
+func normalizeRemoteURL(remoteURL string) string {
+	normalized := remoteURL
+	if parsedURL, err := url.Parse(remoteURL); err == nil && parsedURL.Host != "" {
+		normalized = parsedURL.Hostname() + parsedURL.Path
+	} else if matches := scpLikeURLRegex.FindStringSubmatch(remoteURL); matches != nil {
+		normalized = matches[1] + "/" + strings.TrimPrefix(matches[2], "/")
+	}
+	normalized = strings.TrimSuffix(strings.TrimSuffix(normalized, "/"), ".git")
+	return strings.ToLower(normalized)
+}
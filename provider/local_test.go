@@ -0,0 +1,145 @@
+package provider_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/provider"
+)
+
+var _ = Describe("Local", func() {
+
+	var root string
+	var localConfig config.ProviderConfig
+
+	// Creates a repository with a single commit, origin is only added if remoteURL is set
+	initRepository := func(path, remoteURL string) {
+		repository, err := git.PlainInit(filepath.Join(root, path), false)
+		Expect(err).NotTo(HaveOccurred())
+		if remoteURL != "" {
+			_, err = repository.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{remoteURL}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(ioutil.WriteFile(filepath.Join(root, path, "README.md"), []byte(path), 0600)).To(Succeed())
+		worktree, err := repository.Worktree()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Add("README.md")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = worktree.Commit("Initial commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "Me", Email: "me@example.com", When: time.Now()},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	findRepo := func(repos []*entity.Repository, fullName string) *entity.Repository {
+		for _, repo := range repos {
+			if repo.FullName == fullName {
+				return repo
+			}
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "local_test")
+		Expect(err).NotTo(HaveOccurred())
+		root, err = filepath.EvalSymlinks(root)
+		Expect(err).NotTo(HaveOccurred())
+		root = filepath.Join(root, "code")
+
+		initRepository("app", "https://me@github.com/me/app.git")
+		initRepository("group/lib", "git@github.com:me/lib.git")
+		initRepository("group/lib/vendor/nested", "https://github.com/other/nested.git")
+		initRepository("copy-of-app", "https://github.com/me/app")
+		initRepository("scratch", "")
+		initRepository("a/b/c/deep", "https://github.com/me/deep.git")
+		initRepository(".hidden/tool", "https://github.com/other/tool.git")
+		Expect(ioutil.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0600)).To(Succeed())
+
+		localConfig = config.ProviderConfig{
+			Name:         "local",
+			ProviderName: "local",
+			Paths:        []string{root},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Dir(root))
+	})
+
+	Describe("Creating provider", func() {
+		It("should return with correct provider", func() {
+			p := newProvider(localConfig)
+			Expect(p).To(BeAssignableToTypeOf(&provider.LocalProvider{}))
+			Expect(p.(*provider.LocalProvider).MaxDepth).To(Equal(3))
+		})
+	})
+
+	Describe("Getting repositories", func() {
+		It("should find the repositories within the depth limit", func() {
+			repos, err := newProvider(localConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			fullNames := make([]string, len(repos))
+			for i, repo := range repos {
+				fullNames[i] = repo.FullName
+			}
+			// copy-of-app has the same remote as app, nested repositories and hidden folders are skipped
+			Expect(fullNames).To(ConsistOf("code/app", "code/group/lib", "code/scratch"))
+
+			app := findRepo(repos, "code/app")
+			Expect(app.Name).To(Equal("app"))
+			Expect(app.Provider).To(Equal("local"))
+			Expect(app.LocalPath).To(Equal(filepath.Join(root, "app")))
+			Expect(app.DefaultBranch).To(Equal("master"))
+			Expect(app.CloneURL).To(BeEmpty())
+		})
+
+		It("should scan deeper folders when asked", func() {
+			localConfig.ScanDepth = 4
+			repos, err := newProvider(localConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findRepo(repos, "code/a/b/c/deep")).NotTo(BeNil())
+		})
+
+		It("should derive stable IDs from the remote url or the path", func() {
+			repos, err := newProvider(localConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findRepo(repos, "code/app").ID).To(Equal(md5Hex("github.com/me/app")))
+			Expect(findRepo(repos, "code/group/lib").ID).To(Equal(md5Hex("github.com/me/lib")))
+			Expect(findRepo(repos, "code/scratch").ID).To(Equal(md5Hex(filepath.Join(root, "scratch"))))
+
+			// Moved repositories keep their ID
+			Expect(os.Rename(filepath.Join(root, "app"), filepath.Join(root, "moved-app"))).To(Succeed())
+			Expect(os.RemoveAll(filepath.Join(root, "copy-of-app"))).To(Succeed())
+			repos, err = newProvider(localConfig).GetRepos(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(findRepo(repos, "code/moved-app").ID).To(Equal(md5Hex("github.com/me/app")))
+		})
+
+		It("should return an error for a missing folder", func() {
+			localConfig.Paths = []string{filepath.Join(root, "missing")}
+			_, err := newProvider(localConfig).GetRepos(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+})
+
+func md5Hex(value string) string {
+	hash := md5.Sum([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
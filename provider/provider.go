@@ -1,8 +1,17 @@
 package provider
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
 	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
 )
 
 // Provider describes the interface that must be used for each
@@ -10,15 +19,95 @@ import (
 type Provider interface {
 	// GetRepos retrieves all the repos that are accessible with
 	// the given credentials form the provider.
-	GetRepos() []*entity.Repository
+	GetRepos(ctx context.Context) ([]*entity.Repository, error)
 }
 
 // NewProvider returns appropriate provider for given name
-func NewProvider(c config.Config) Provider {
+func NewProvider(c config.ProviderConfig) (Provider, error) {
 	if c.ProviderName == "github.com" {
 		return NewGithubProvider(c)
 	} else if c.ProviderName == "bitbucket.org" {
 		return NewBitbucketProvider(c)
+	} else if c.ProviderName == "gitlab.com" {
+		return NewGitlabProvider(c)
+	} else if c.ProviderName == "bitbucket-server" {
+		return NewBitbucketServerProvider(c)
+	} else if c.ProviderName == "gitea" {
+		return NewGiteaProvider(c)
+	} else if c.ProviderName == "dev.azure.com" {
+		return NewAzureProvider(c)
+	} else if c.ProviderName == "local" {
+		return NewLocalProvider(c), nil
+	}
+	return nil, fmt.Errorf("Unknown provider %q (%s)", c.ProviderName, c.Name)
+}
+
+// doRequest sends the request and decodes the JSON response into v.
+// Network errors and temporary API errors are retried with the given policy,
+// other non 2xx responses are returned as *APIError.
+func doRequest(providerName string, client *http.Client, policy retry.Policy, request *http.Request, v interface{}) (http.Header, error) {
+	var header http.Header
+	ctx := request.Context()
+	err := retry.Do(ctx, policy, func() error {
+		var err error
+		header, err = sendRequest(providerName, client, request, v)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		var apiError *APIError
+		if errors.As(err, &apiError) {
+			if !apiError.Temporary() {
+				return retry.Permanent(err)
+			}
+			return retry.After(err, apiError.RetryAfter)
+		}
+		if isCertificateError(err) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	return header, err
+}
+
+// Untrusted certificates (e.g. missing CA bundle) won't be trusted on the next attempt either
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname)
+}
+
+func sendRequest(providerName string, client *http.Client, request *http.Request, v interface{}) (http.Header, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, newAPIError(providerName, response, body)
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return nil, retry.Permanent(fmt.Errorf("Couldn't parse %s response: %s", providerName, err.Error()))
+	}
+	return response.Header, nil
+}
+
+// Clients of self-managed instances can trust an internal CA
+func newHTTPClient(c config.ProviderConfig) (*http.Client, error) {
+	var caCerts []string
+	if c.CACert != "" {
+		caCerts = append(caCerts, c.CACert)
+	}
+	client, err := config.NewHTTPClient(caCerts...)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't load CA bundle of %s: %s", c.Name, err.Error())
 	}
-	panic(c.ProviderName + " not implemented yet")
+	return client, nil
 }
@@ -0,0 +1,233 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gookit/color"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+)
+
+// cleanupOptions limits the disk space used by clones
+type cleanupOptions struct {
+	// DeleteAfterProcessing removes a clone as soon as its repository is processed
+	DeleteAfterProcessing bool
+	// KeepClones is the number of most recently used clones kept, 0 keeps every clone
+	KeepClones int
+	// MaxSize is the disk budget of all clones in bytes, 0 means no limit
+	MaxSize int64
+}
+
+// localClone is a clone found in the workspace
+type localClone struct {
+	Path string
+	// LastUsed is the modification time of the clone folder, it is updated every time the clone is used
+	LastUsed time.Time
+	Size     int64
+}
+
+// Marks the clone as used, least recently used clones are deleted first
+func (r *repositoryService) touchClone(repo *entity.Repository) error {
+	now := time.Now()
+	return os.Chtimes(r.getRepoPath(repo), now, now)
+}
+
+func (r *repositoryService) deleteClone(repo *entity.Repository) error {
+	return removeClone(r.SaveRepoPath, r.getRepoPath(repo))
+}
+
+// Deletes least recently used clones until they fit into KeepClones and MaxSize.
+// Clones in use are never deleted, they count as the most recently used ones.
+func (r *repositoryService) enforceCloneLimits(inUse map[string]bool) error {
+	if r.Cleanup.KeepClones == 0 && r.Cleanup.MaxSize == 0 {
+		return nil
+	}
+	clones, err := findClones(r.SaveRepoPath)
+	if err != nil {
+		return err
+	}
+	sort.Slice(clones, func(i, j int) bool {
+		if inUse[clones[i].Path] != inUse[clones[j].Path] {
+			return inUse[clones[i].Path]
+		}
+		return clones[i].LastUsed.After(clones[j].LastUsed)
+	})
+
+	var totalSize int64
+	for i, clone := range clones {
+		totalSize += clone.Size
+		keep := r.Cleanup.KeepClones == 0 || i < r.Cleanup.KeepClones
+		if r.Cleanup.MaxSize > 0 && totalSize > r.Cleanup.MaxSize {
+			keep = false
+		}
+		if keep || inUse[clone.Path] {
+			continue
+		}
+		totalSize -= clone.Size
+		fmt.Printf("Deleting least recently used clone %s\n", color.Info.Sprint(r.getRelativePath(clone.Path)))
+		err = removeClone(r.SaveRepoPath, clone.Path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clones of the repositories being processed, including the temporary folders of recloning.
+// Caller holds the mutex.
+func (r *repositoryService) getClonesInUse() map[string]bool {
+	inUse := make(map[string]bool, 2*len(r.CurrentRepositories))
+	for _, repo := range r.CurrentRepositories {
+		repoPath := filepath.Clean(r.getRepoPath(repo))
+		inUse[repoPath] = true
+		inUse[repoPath+".reclone"] = true
+	}
+	return inUse
+}
+
+// RemoveOrphans deletes clones and results of repositories which aren't in the given list anymore.
+// Only clones of the given providers are checked, others (e.g. providers which couldn't be reached) are kept.
+func (r *repositoryService) RemoveOrphans(repos []*entity.Repository, providers []string) error {
+	repoPaths := make(map[string]bool, len(repos))
+	resultPaths := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		repoPaths[filepath.Clean(r.getRepoPath(repo))] = true
+		resultPaths[filepath.Clean(r.getResultPath(repo))] = true
+	}
+
+	for _, provider := range providers {
+		clones, err := findClones(filepath.Join(r.SaveRepoPath, provider))
+		if err != nil {
+			return err
+		}
+		for _, clone := range clones {
+			if repoPaths[clone.Path] {
+				continue
+			}
+			fmt.Printf("Deleting orphaned clone %s\n", color.Info.Sprint(r.getRelativePath(clone.Path)))
+			err = removeClone(r.SaveRepoPath, clone.Path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	results, err := filepath.Glob(filepath.Join(r.ResultPath, "*.zip"))
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if resultPaths[result] || !r.isResultOf(filepath.Base(result), providers) {
+			continue
+		}
+		fmt.Printf("Deleting orphaned result %s\n", color.Info.Sprint(filepath.Base(result)))
+		err = os.Remove(result)
+		if err != nil {
+			return err
+		}
+	}
+	return r.enforceCloneLimits(nil)
+}
+
+// Results are named after UniqueID, which starts with the provider name.
+// Provider names can contain "-" too, so the longest matching provider owns the result.
+func (r *repositoryService) isResultOf(fileName string, providers []string) bool {
+	owner := ""
+	for provider := range r.Providers {
+		if strings.HasPrefix(fileName, provider+"-") && len(provider) > len(owner) {
+			owner = provider
+		}
+	}
+	for _, provider := range providers {
+		if provider == owner {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *repositoryService) getRelativePath(path string) string {
+	relativePath, err := filepath.Rel(r.SaveRepoPath, path)
+	if err != nil {
+		return path
+	}
+	return relativePath
+}
+
+// Reports if path is root or inside of it
+func isInside(root, path string) bool {
+	absoluteRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	relativePath, err := filepath.Rel(absoluteRoot, absolutePath)
+	if err != nil {
+		return false
+	}
+	return relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
+
+// Clones are the folders with a .git entry, their content isn't walked
+func findClones(root string) ([]localClone, error) {
+	clones := make([]localClone, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			return nil
+		}
+		size, err := getDirSize(path)
+		if err != nil {
+			return err
+		}
+		clones = append(clones, localClone{Path: path, LastUsed: info.ModTime(), Size: size})
+		return filepath.SkipDir
+	})
+	return clones, err
+}
+
+func getDirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Deletes the clone and its parent folders (e.g. owner folder) which became empty, up to root
+func removeClone(root, path string) error {
+	err := os.RemoveAll(path)
+	if err != nil {
+		return err
+	}
+	root = filepath.Clean(root)
+	for parent := filepath.Dir(path); parent != root && strings.HasPrefix(parent, root); parent = filepath.Dir(parent) {
+		// Remove fails if the folder isn't empty
+		if os.Remove(parent) != nil {
+			break
+		}
+	}
+	return nil
+}
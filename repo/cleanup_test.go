@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+)
+
+var _ = Describe("Cleanup", func() {
+
+	var appPath string
+	var service *repositoryService
+	var repos []*entity.Repository
+
+	// Fake clone with a file of the given size, used the given number of hours ago
+	createClone := func(repo *entity.Repository, size int, hoursAgo int) {
+		repoPath := service.getRepoPath(repo)
+		Expect(os.MkdirAll(filepath.Join(repoPath, ".git"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repoPath, "file"), make([]byte, size), 0600)).To(Succeed())
+		lastUsed := time.Now().Add(-time.Duration(hoursAgo) * time.Hour)
+		Expect(os.Chtimes(repoPath, lastUsed, lastUsed)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		appPath, err = ioutil.TempDir("", "cleanup_test")
+		Expect(err).NotTo(HaveOccurred())
+		service = &repositoryService{
+			Providers: map[string]config.ProviderConfig{
+				"github.com":      {Name: "github.com"},
+				"github.com-work": {Name: "github.com-work"},
+			},
+			SaveRepoPath: filepath.Join(appPath, "tmp"),
+			ResultPath:   filepath.Join(appPath, "results"),
+		}
+		Expect(os.Mkdir(service.SaveRepoPath, 0700)).To(Succeed())
+		Expect(os.Mkdir(service.ResultPath, 0700)).To(Succeed())
+		repos = []*entity.Repository{
+			{ID: "1", FullName: "me/first", Provider: "github.com"},
+			{ID: "2", FullName: "me/second", Provider: "github.com"},
+			{ID: "3", FullName: "me/third", Provider: "github.com"},
+			{ID: "4", FullName: "company/work", Provider: "github.com-work"},
+		}
+		for i, repo := range repos {
+			createClone(repo, 100, len(repos)-i)
+			Expect(ioutil.WriteFile(service.getResultPath(repo), []byte("result"), 0600)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+
+	It("should find clones without walking into them", func() {
+		clones, err := findClones(service.SaveRepoPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clones).To(HaveLen(4))
+		for _, clone := range clones {
+			Expect(clone.Size).To(BeNumerically("==", 100))
+		}
+		clones, err = findClones(filepath.Join(service.SaveRepoPath, "gitlab.com"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clones).To(BeEmpty())
+	})
+
+	It("should keep the most recently used clones", func() {
+		service.Cleanup.KeepClones = 2
+		Expect(service.enforceCloneLimits(nil)).To(Succeed())
+		Expect(service.getRepoPath(repos[0])).NotTo(BeADirectory())
+		Expect(service.getRepoPath(repos[1])).NotTo(BeADirectory())
+		Expect(service.getRepoPath(repos[2])).To(BeADirectory())
+		Expect(service.getRepoPath(repos[3])).To(BeADirectory())
+		// Owner folders with remaining clones are kept
+		Expect(filepath.Join(service.SaveRepoPath, "github.com", "me")).To(BeADirectory())
+		Expect(filepath.Join(service.SaveRepoPath, "github.com-work", "company")).To(BeADirectory())
+	})
+
+	It("should delete least recently used clones above the disk budget", func() {
+		service.Cleanup.MaxSize = 250
+		Expect(service.touchClone(repos[0])).To(Succeed())
+		Expect(service.enforceCloneLimits(nil)).To(Succeed())
+		Expect(service.getRepoPath(repos[0])).To(BeADirectory())
+		Expect(service.getRepoPath(repos[1])).NotTo(BeADirectory())
+		Expect(service.getRepoPath(repos[2])).NotTo(BeADirectory())
+		Expect(service.getRepoPath(repos[3])).To(BeADirectory())
+	})
+
+	It("should not delete clones in use", func() {
+		service.Cleanup.KeepClones = 1
+		inUse := map[string]bool{filepath.Clean(service.getRepoPath(repos[0])): true}
+		Expect(service.enforceCloneLimits(inUse)).To(Succeed())
+		Expect(service.getRepoPath(repos[0])).To(BeADirectory())
+		for _, repo := range repos[1:] {
+			Expect(service.getRepoPath(repo)).NotTo(BeADirectory())
+		}
+	})
+
+	It("should remove folders which became empty when a clone is deleted", func() {
+		Expect(service.deleteClone(repos[3])).To(Succeed())
+		Expect(filepath.Join(service.SaveRepoPath, "github.com-work")).NotTo(BeADirectory())
+		Expect(service.SaveRepoPath).To(BeADirectory())
+	})
+
+	It("should remove orphaned clones and results of the listed providers only", func() {
+		Expect(service.RemoveOrphans(repos[:1], []string{"github.com"})).To(Succeed())
+		Expect(service.getRepoPath(repos[0])).To(BeADirectory())
+		Expect(service.getResultPath(repos[0])).To(BeAnExistingFile())
+		for _, repo := range repos[1:3] {
+			Expect(service.getRepoPath(repo)).NotTo(BeADirectory())
+			Expect(service.getResultPath(repo)).NotTo(BeAnExistingFile())
+		}
+		// github.com-work wasn't listed, even though its results start with "github.com-"
+		Expect(service.getRepoPath(repos[3])).To(BeADirectory())
+		Expect(service.getResultPath(repos[3])).To(BeAnExistingFile())
+	})
+
+})
@@ -0,0 +1,439 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// cloneStrategy describes how much of a repository is cloned and updated
+type cloneStrategy struct {
+	// Name is one of full, single-branch, shallow and no-checkout
+	Name string
+	// Depth is the number of commits fetched by the shallow strategy
+	Depth int
+	// Since makes the shallow strategy fetch at least the commits made after it
+	Since time.Time
+}
+
+var fullCloneStrategy = cloneStrategy{Name: "full"}
+
+func (s cloneStrategy) getCloneOptions(url string, auth transport.AuthMethod, branch plumbing.ReferenceName) *git.CloneOptions {
+	options := &git.CloneOptions{
+		URL:  url,
+		Auth: auth,
+		//Prognress: os.Stdout,
+		// TODO add verbose flag to show/hide these.
+	}
+	switch s.Name {
+	case "single-branch":
+		options.SingleBranch = true
+		options.ReferenceName = branch
+	case "shallow":
+		options.SingleBranch = true
+		options.ReferenceName = branch
+		options.Depth = s.Depth
+	case "no-checkout":
+		options.NoCheckout = true
+	}
+	return options
+}
+
+// cloneStatus describes what happened to a repository during cloning
+type cloneStatus string
+
+const (
+	cloneStatusCloned   cloneStatus = "cloned"
+	cloneStatusUpdated  cloneStatus = "updated"
+	cloneStatusUpToDate cloneStatus = "up to date"
+	cloneStatusRecloned cloneStatus = "cloned again"
+)
+
+// cloneResult is reported to the user for each repository
+type cloneResult struct {
+	Status cloneStatus
+	// Reason why the repository was cloned again
+	Reason error
+}
+
+var (
+	errHistoryRewritten = errors.New("history was rewritten on the remote")
+	errTooShallow       = errors.New("shallow clone doesn't reach the since date")
+)
+
+// corruptCloneError is returned when the clone itself can't be updated (e.g. missing objects or broken refs),
+// cloning it again fixes it
+type corruptCloneError struct {
+	err error
+}
+
+func (e *corruptCloneError) Error() string {
+	return e.err.Error()
+}
+
+func (e *corruptCloneError) Unwrap() error {
+	return e.err
+}
+
+func corrupt(err error) error {
+	return &corruptCloneError{err: err}
+}
+
+// Only rewritten, too shallow or corrupted clones are cloned again, other errors (network errors, rejected credentials)
+// would happen again while cloning
+func needsReclone(err error) bool {
+	var corruptErr *corruptCloneError
+	return errors.Is(err, errHistoryRewritten) || errors.Is(err, errTooShallow) || errors.As(err, &corruptErr)
+}
+
+// Clone repository from given url to given path, or update it if it is already cloned.
+// Branch is the default branch of the repository, HEAD is used if it is empty.
+// Cancelling the context rolls back new clones, half cloned repositories are never left behind.
+func cloneRepository(ctx context.Context, url, path, name string, auth transport.AuthMethod, strategy cloneStrategy, branch string) (cloneResult, error) {
+	referenceName := plumbing.HEAD
+	if branch != "" {
+		referenceName = plumbing.NewBranchReferenceName(branch)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return cloneResult{Status: cloneStatusCloned}, newClone(ctx, url, path, auth, strategy, referenceName)
+	}
+
+	status, updateErr := updateRepository(ctx, url, path, auth, strategy, branch)
+	if updateErr == nil {
+		return cloneResult{Status: status}, nil
+	}
+	if ctx.Err() != nil {
+		return cloneResult{}, ctx.Err()
+	}
+	if !needsReclone(updateErr) {
+		return cloneResult{}, updateErr
+	}
+
+	// Rewritten or corrupted clones are cloned again. Clone goes to a temporary folder first
+	// so the existing clone is kept if cloning fails too (e.g. the remote is unreachable).
+	reclonePath := path + ".reclone"
+	os.RemoveAll(reclonePath)
+	cloneErr := newClone(ctx, url, reclonePath, auth, strategy, referenceName)
+	if cloneErr != nil {
+		return cloneResult{}, fmt.Errorf("Couldn't update existing clone (%s) nor clone it again (%w)", updateErr.Error(), cloneErr)
+	}
+	err := os.RemoveAll(path)
+	if err == nil {
+		err = os.Rename(reclonePath, path)
+	}
+	return cloneResult{Status: cloneStatusRecloned, Reason: updateErr}, err
+}
+
+// Rejected credentials and missing or empty repositories won't change by trying again,
+// anything else (network errors, server errors) may be temporary.
+func isTemporaryCloneError(err error) bool {
+	for _, permanent := range []error{
+		transport.ErrAuthenticationRequired,
+		transport.ErrAuthorizationFailed,
+		transport.ErrInvalidAuthMethod,
+		transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	return true
+}
+
+// Path is removed if cloning fails or it is cancelled
+func newClone(ctx context.Context, url, path string, auth transport.AuthMethod, strategy cloneStrategy, branch plumbing.ReferenceName) error {
+	_, err := git.PlainCloneContext(ctx, path, false, strategy.getCloneOptions(url, auth, branch))
+	if err == nil && strategy.Name == "shallow" && !strategy.Since.IsZero() {
+		err = deepenUntil(ctx, url, path, auth, strategy, branch)
+	}
+	if err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	return nil
+}
+
+// Fetches all refs and resets the default branch to the remote one. Pull can't handle
+// force pushed branches and leaves the clone in its old state if there are local changes.
+func updateRepository(ctx context.Context, url, path string, auth transport.AuthMethod, strategy cloneStrategy, branch string) (cloneStatus, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return "", corrupt(err)
+	}
+	err = setOriginURL(repo, url)
+	if err != nil {
+		return "", corrupt(err)
+	}
+	if branch == "" {
+		branch, err = getCurrentBranch(repo)
+		if err != nil {
+			return "", corrupt(err)
+		}
+	}
+	remoteReferenceName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch)
+	var oldHash plumbing.Hash
+	if reference, err := repo.Reference(remoteReferenceName, true); err == nil {
+		oldHash = reference.Hash()
+	}
+	// Fetch needs the commits of the clone to negotiate with the remote
+	if !oldHash.IsZero() {
+		if _, err := repo.CommitObject(oldHash); err != nil {
+			return "", corrupt(err)
+		}
+	}
+
+	fetchOptions := &git.FetchOptions{RemoteName: git.DefaultRemoteName, Auth: auth, Force: true}
+	if strategy.Name == "shallow" {
+		err = fetchShallow(ctx, repo, fetchOptions, strategy)
+	} else {
+		err = repo.FetchContext(ctx, fetchOptions)
+	}
+	// Objects the refs point to are missing from the clone
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return "", corrupt(err)
+	}
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", err
+	}
+
+	remoteReference, err := repo.Reference(remoteReferenceName, true)
+	if err != nil {
+		return "", corrupt(err)
+	}
+	newHash := remoteReference.Hash()
+	status := cloneStatusUpdated
+	if newHash == oldHash {
+		status = cloneStatusUpToDate
+	} else if !oldHash.IsZero() && strategy.Name != "shallow" {
+		// Shallow clones are refreshed from the new commit, old history isn't reachable from it
+		// so rewritten history doesn't have to be cloned again
+		fastForward, err := isFastForward(repo, oldHash, newHash)
+		if err != nil {
+			return "", corrupt(err)
+		}
+		if !fastForward {
+			return "", errHistoryRewritten
+		}
+	}
+
+	// Point the local default branch and HEAD to the remote branch, local changes are discarded
+	localReferenceName := plumbing.NewBranchReferenceName(branch)
+	err = repo.Storer.SetReference(plumbing.NewHashReference(localReferenceName, newHash))
+	if err != nil {
+		return "", corrupt(err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, localReferenceName))
+	if err != nil {
+		return "", corrupt(err)
+	}
+	if strategy.Name == "shallow" && !strategy.Since.IsZero() && status == cloneStatusUpdated {
+		err = checkSince(repo, strategy.Since)
+		if err != nil {
+			return "", err
+		}
+	}
+	if strategy.Name == "no-checkout" {
+		return status, nil
+	}
+	workTree, err := repo.Worktree()
+	if err != nil {
+		return "", corrupt(err)
+	}
+	err = workTree.Reset(&git.ResetOptions{Commit: newHash, Mode: git.HardReset})
+	if err != nil {
+		return "", corrupt(err)
+	}
+	return status, nil
+}
+
+// Fetch of go-git walks the local history to tell the remote which commits are already cloned,
+// this fails at the first missing parent of a shallow clone. Local refs are hidden from the fetch,
+// so the remote sends the last commits of the new history like it does for a new shallow clone.
+// As many commits are fetched as the clone has, so it doesn't get shorter than strategy.Since required.
+func fetchShallow(ctx context.Context, repo *git.Repository, options *git.FetchOptions, strategy cloneStrategy) error {
+	origin, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return corrupt(err)
+	}
+	count := 0
+	err = walkCommits(repo, func(c *object.Commit, shallow bool) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return corrupt(err)
+	}
+	options.Depth = strategy.Depth
+	if count > options.Depth {
+		options.Depth = count
+	}
+	remote := git.NewRemote(withoutReferences{repo.Storer}, origin.Config())
+	return remote.FetchContext(ctx, options)
+}
+
+// withoutReferences hides the local refs from the fetch, everything else goes to the clone
+type withoutReferences struct {
+	storage.Storer
+}
+
+func (withoutReferences) IterReferences() (storer.ReferenceIter, error) {
+	return storer.NewReferenceSliceIter(nil), nil
+}
+
+// Shallow clones refreshed by an update can lose the commits made after strategy.Since,
+// these are cloned again with the depth required by it
+func checkSince(repo *git.Repository, since time.Time) error {
+	shallowCommits, err := repo.Storer.Shallow()
+	if err != nil {
+		return corrupt(err)
+	}
+	if len(shallowCommits) == 0 {
+		return nil
+	}
+	oldest, err := getOldestCommitTime(repo)
+	if err != nil {
+		return corrupt(err)
+	}
+	if oldest.Before(since) {
+		return nil
+	}
+	return errTooShallow
+}
+
+// Name of the branch HEAD points to
+func getCurrentBranch(repo *git.Repository) (string, error) {
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return "", err
+	}
+	if head.Type() != plumbing.SymbolicReference || !head.Target().IsBranch() {
+		return "", errors.New("HEAD is not a branch")
+	}
+	return head.Target().Short(), nil
+}
+
+func isFastForward(repo *git.Repository, oldHash, newHash plumbing.Hash) (bool, error) {
+	oldCommit, err := repo.CommitObject(oldHash)
+	if err != nil {
+		return false, err
+	}
+	newCommit, err := repo.CommitObject(newHash)
+	if err != nil {
+		return false, err
+	}
+	return oldCommit.IsAncestor(newCommit)
+}
+
+// go-git can't deepen shallow clones, so the repository is cloned again with doubled depth
+// until the oldest commit is older than strategy.Since or the whole history is cloned.
+func deepenUntil(ctx context.Context, url, path string, auth transport.AuthMethod, strategy cloneStrategy, branch plumbing.ReferenceName) error {
+	for {
+		repo, err := git.PlainOpen(path)
+		if err != nil {
+			return err
+		}
+		shallowCommits, err := repo.Storer.Shallow()
+		if err != nil {
+			return err
+		}
+		if len(shallowCommits) == 0 {
+			return nil
+		}
+		oldest, err := getOldestCommitTime(repo)
+		if err != nil {
+			return err
+		}
+		if oldest.Before(strategy.Since) {
+			return nil
+		}
+
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		strategy.Depth *= 2
+		_, err = git.PlainCloneContext(ctx, path, false, strategy.getCloneOptions(url, auth, branch))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func getOldestCommitTime(repo *git.Repository) (time.Time, error) {
+	var oldest time.Time
+	err := walkCommits(repo, func(c *object.Commit, shallow bool) error {
+		if oldest.IsZero() || c.Committer.When.Before(oldest) {
+			oldest = c.Committer.When
+		}
+		return nil
+	})
+	return oldest, err
+}
+
+// Older versions saved the token in the origin url, these are replaced with the credential free url
+func setOriginURL(repo *git.Repository, url string) error {
+	repoConfig, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	origin, ok := repoConfig.Remotes[git.DefaultRemoteName]
+	if !ok || (len(origin.URLs) == 1 && origin.URLs[0] == url) {
+		return nil
+	}
+	origin.URLs = []string{url}
+	return repo.Storer.SetConfig(repoConfig)
+}
+
+// Authenticates with the given private key or with ssh-agent if the key is not set.
+// Hosts are verified with the given known_hosts file or with the default ones.
+func newSSHAuth(keyPath, passphrase, knownHostsPath string) (transport.AuthMethod, error) {
+	knownHostsFiles := make([]string, 0, 1)
+	if knownHostsPath != "" {
+		knownHostsFiles = append(knownHostsFiles, knownHostsPath)
+	}
+	hostKeyCallback, err := ssh.NewKnownHostsCallback(knownHostsFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyPath != "" {
+		auth, err := ssh.NewPublicKeysFromFile("git", keyPath, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		auth.HostKeyCallback = hostKeyCallback
+		return auth, nil
+	}
+	auth, err := ssh.NewSSHAgentAuth("git")
+	if err != nil {
+		return nil, err
+	}
+	auth.HostKeyCallback = hostKeyCallback
+	return auth, nil
+}
+
+var urlCredentialsRegex = regexp.MustCompile(`(://)[^/@\s]+@`)
+
+func scrubSecrets(message string, secrets []string) string {
+	message = urlCredentialsRegex.ReplaceAllString(message, "${1}***@")
+	for _, secret := range secrets {
+		if secret != "" {
+			message = strings.Replace(message, secret, "***", -1)
+		}
+	}
+	return message
+}
@@ -0,0 +1,260 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+)
+
+// resultFileName is the name of the file every extractor must create in its output folder
+const resultFileName = "repo_data.json.zip"
+
+// scriptName is the headless docker script of repo_info_extractor
+// TODO handle windows (.bat files)
+const scriptName = "run-docker-headless.sh"
+
+// Extractor analyses a cloned repository and produces the zipped repo_info_extractor result
+type Extractor interface {
+	// Init prepares the extractor, e.g. downloads scripts or checks that the binary exists
+	Init(ctx context.Context) error
+	// Extract analyses the repository at repoPath and writes the result to outputPath/repo_data.json.zip.
+	// Cancelling the context stops the extraction with every process it started.
+	Extract(ctx context.Context, repoPath, outputPath string, emails []string) error
+}
+
+// NewExtractor returns the extractor selected in the config
+func NewExtractor(c config.Config) (Extractor, error) {
+	switch c.Extractor {
+	case "docker":
+		return &dockerExtractor{
+			Path:    c.RepoInfoExtractorPath,
+			URL:     "https://github.com/codersrank-org/repo_info_extractor",
+			Managed: c.ManagedRepoInfoExtractor,
+		}, nil
+	case "binary":
+		return &binaryExtractor{
+			Binary: c.ExtractorBinary,
+		}, nil
+	case "container":
+		return &containerExtractor{
+			Runtime: c.ContainerRuntime,
+			Image:   c.ExtractorImage,
+		}, nil
+	case "native":
+		return &nativeExtractor{}, nil
+	}
+	return nil, fmt.Errorf("Unknown extractor %s", c.Extractor)
+}
+
+// dockerExtractor runs the docker script of a repo_info_extractor clone
+type dockerExtractor struct {
+	Path string
+	URL  string
+	// Managed is set when Path is the folder in the cache, it is reset or cloned again like any other clone.
+	// Checkouts of the user are only fast-forwarded.
+	Managed bool
+	// mutex serializes the extractions, the script writes its result into Path
+	mutex sync.Mutex
+}
+
+func (e *dockerExtractor) Init(ctx context.Context) error {
+	if e.Managed {
+		_, err := cloneRepository(ctx, e.URL, e.Path, "Repo Info Extractor", nil, fullCloneStrategy, "")
+		return err
+	}
+	if _, err := os.Stat(e.Path); os.IsNotExist(err) {
+		return newClone(ctx, e.URL, e.Path, nil, fullCloneStrategy, plumbing.HEAD)
+	}
+	err := fastForward(ctx, e.Path)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// Local changes, diverged branches or a folder which isn't a clone are used as they are
+	if err != nil {
+		fmt.Printf("Couldn't update repo_info_extractor in %s, using it as it is. Error: %s\n", e.Path, err.Error())
+	}
+	return nil
+}
+
+// Pulls new commits of origin if the branch can be fast-forwarded and there are no local changes
+func fastForward(ctx context.Context, path string) error {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return err
+	}
+	workTree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	err = workTree.PullContext(ctx, &git.PullOptions{RemoteName: git.DefaultRemoteName})
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+func (e *dockerExtractor) Extract(ctx context.Context, repoPath, outputPath string, emails []string) error {
+	path, err := filepath.Abs(e.Path)
+	if err != nil {
+		return err
+	}
+	// The script has to run in the repo_info_extractor folder (e.g. docker builds the image from it)
+	// and it writes its result there too, so only one extraction runs at a time
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	resultPath := filepath.Join(path, resultFileName)
+	// Result of an extraction which was interrupted before it was moved
+	os.Remove(resultPath)
+
+	cmd := exec.Command(filepath.Join(path, scriptName), repoPath, "--email="+strings.Join(emails, ","), "--skip_upload", "--headless")
+	cmd.Dir = path
+	err = runExtractorCommand(ctx, cmd)
+	if ctx.Err() != nil {
+		// Killing the docker CLI doesn't stop the container started by the script.
+		// It is found by the repository it mounts, repoPath is absolute like the mounts docker shows.
+		removeContainers("docker", repoPath)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(resultPath, filepath.Join(outputPath, resultFileName))
+}
+
+// Removes the containers which have the folder mounted, the docker script doesn't name its container
+func removeContainers(runtime, mountPath string) {
+	output, err := exec.Command(runtime, "ps", "--all", "--quiet", "--filter", "volume="+mountPath).Output()
+	if err != nil {
+		return
+	}
+	for _, id := range strings.Fields(string(output)) {
+		exec.Command(runtime, "rm", "--force", id).Run()
+	}
+}
+
+func (e *dockerExtractor) getScriptPath() string {
+	return e.Path + "/" + scriptName
+}
+
+// binaryExtractor runs a locally installed repo_info_extractor binary
+type binaryExtractor struct {
+	Binary string
+}
+
+func (e *binaryExtractor) Init(ctx context.Context) error {
+	binaryPath, err := exec.LookPath(e.Binary)
+	if err != nil {
+		return fmt.Errorf("Couldn't find repo_info_extractor binary %s: %s", e.Binary, err.Error())
+	}
+	e.Binary = binaryPath
+	return nil
+}
+
+func (e *binaryExtractor) Extract(ctx context.Context, repoPath, outputPath string, emails []string) error {
+	cmd := exec.Command(e.Binary, getExtractorArgs(repoPath, outputPath, emails)...)
+	cmd.Dir = outputPath
+	err := runExtractorCommand(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	return renameResult(outputPath)
+}
+
+// containerExtractor runs the repo_info_extractor image with a docker compatible
+// container runtime, like podman or nerdctl
+type containerExtractor struct {
+	Runtime string
+	Image   string
+}
+
+func (e *containerExtractor) Init(ctx context.Context) error {
+	runtimePath, err := exec.LookPath(e.Runtime)
+	if err != nil {
+		return fmt.Errorf("Couldn't find container runtime %s: %s", e.Runtime, err.Error())
+	}
+	e.Runtime = runtimePath
+	return runExtractorCommand(ctx, exec.Command(e.Runtime, "pull", e.Image))
+}
+
+func (e *containerExtractor) Extract(ctx context.Context, repoPath, outputPath string, emails []string) error {
+	// Named, so the container can be removed if the runtime doesn't stop it with the process
+	name := "repo_info_extractor-" + md5Hash(outputPath)
+	args := []string{
+		"run", "--rm",
+		"--name", name,
+		"-v", repoPath + ":/repo",
+		"-v", outputPath + ":/output",
+		e.Image,
+	}
+	args = append(args, getExtractorArgs("/repo", "/output", emails)...)
+	err := runExtractorCommand(ctx, exec.Command(e.Runtime, args...))
+	if ctx.Err() != nil {
+		exec.Command(e.Runtime, "rm", "--force", name).Run()
+	}
+	if err != nil {
+		return err
+	}
+	return renameResult(outputPath)
+}
+
+// Command line arguments of the repo_info_extractor binary
+func getExtractorArgs(repoPath, outputPath string, emails []string) []string {
+	return []string{
+		"local",
+		"--repo_path=" + repoPath,
+		"--emails=" + strings.Join(emails, ","),
+		"--output_path=" + outputPath,
+		"--skip_upload",
+		"--headless",
+	}
+}
+
+// repo_info_extractor binary names its result after the repository,
+// rename it so every extractor produces the same file.
+func renameResult(outputPath string) error {
+	resultPath := filepath.Join(outputPath, resultFileName)
+	if _, err := os.Stat(resultPath); err == nil {
+		return nil
+	}
+	files, err := ioutil.ReadDir(outputPath)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".zip") {
+			return os.Rename(filepath.Join(outputPath, file.Name()), resultPath)
+		}
+	}
+	return errors.New("repo_info_extractor didn't create a result file")
+}
+
+func runExtractorCommand(ctx context.Context, cmd *exec.Cmd) error {
+	// We can use these to print repo_info_extractor output to the screen.
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	err := runCommand(ctx, cmd)
+	if err != nil {
+		if stderr.Len() == 0 || ctx.Err() != nil {
+			return err
+		}
+		return errors.New(stderr.String())
+	}
+	return nil
+}
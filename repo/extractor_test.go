@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+)
+
+// Fake repo_info_extractor binary, it saves its arguments as the result named after the repository
+const fakeExtractorBinary = `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		--output_path=*) output="${arg#--output_path=}" ;;
+	esac
+done
+echo "$@" > "$output/myrepo_v2.json.zip"
+`
+
+// Fake docker CLI, it logs its arguments and lists a single container
+const fakeDocker = `#!/bin/sh
+echo "$@" >> "$(dirname "$0")/docker.log"
+if [ "$1" = "ps" ]; then
+	echo "container-id"
+fi
+`
+
+var _ = Describe("Extractor", func() {
+
+	Describe("Creating extractor", func() {
+		It("should return the extractor selected in the config", func() {
+			extractor, err := NewExtractor(config.Config{Extractor: "container", ContainerRuntime: "nerdctl", ExtractorImage: "image"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(extractor).To(Equal(&containerExtractor{Runtime: "nerdctl", Image: "image"}))
+		})
+
+		It("should return an error for unknown extractors", func() {
+			_, err := NewExtractor(config.Config{Extractor: "unknown"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Binary extractor", func() {
+		var tmpPath string
+
+		BeforeEach(func() {
+			var err error
+			tmpPath, err = ioutil.TempDir("", "extractor_test")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpPath)
+		})
+
+		It("should pass the arguments and rename the result", func() {
+			binaryPath := filepath.Join(tmpPath, "repo_info_extractor")
+			Expect(ioutil.WriteFile(binaryPath, []byte(fakeExtractorBinary), 0700)).To(Succeed())
+			outputPath := filepath.Join(tmpPath, "output")
+			Expect(os.Mkdir(outputPath, 0700)).To(Succeed())
+
+			extractor := &binaryExtractor{Binary: binaryPath}
+			Expect(extractor.Init(context.Background())).To(Succeed())
+			Expect(extractor.Extract(context.Background(), "/tmp/myrepo", outputPath, []string{"one@example.com", "two@example.com"})).To(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(outputPath, resultFileName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("local --repo_path=/tmp/myrepo --emails=one@example.com,two@example.com --output_path=" + outputPath + " --skip_upload --headless\n"))
+		})
+
+		It("should fail when the binary doesn't exist", func() {
+			extractor := &binaryExtractor{Binary: filepath.Join(tmpPath, "missing")}
+			Expect(extractor.Init(context.Background())).NotTo(Succeed())
+		})
+	})
+
+	Describe("Docker extractor", func() {
+		var tmpPath, path string
+
+		BeforeEach(func() {
+			var err error
+			tmpPath, err = ioutil.TempDir("", "extractor_test")
+			Expect(err).NotTo(HaveOccurred())
+			binPath := filepath.Join(tmpPath, "bin")
+			Expect(os.Mkdir(binPath, 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(binPath, "docker"), []byte(fakeDocker), 0700)).To(Succeed())
+			path = os.Getenv("PATH")
+			os.Setenv("PATH", binPath+string(os.PathListSeparator)+path)
+		})
+
+		AfterEach(func() {
+			os.Setenv("PATH", path)
+			os.RemoveAll(tmpPath)
+		})
+
+		Describe("Updating the checkout of the user", func() {
+			var remote *git.Repository
+			var remoteURL, checkoutPath string
+
+			BeforeEach(func() {
+				var err error
+				remotePath := filepath.Join(tmpPath, "remote")
+				remote, err = git.PlainInit(remotePath, false)
+				Expect(err).NotTo(HaveOccurred())
+				commitFile(remote, "README.md", "first", "me@example.com")
+				remoteURL = "file://" + remotePath
+				checkoutPath = filepath.Join(tmpPath, "repo_info_extractor")
+			})
+
+			getHead := func(repo *git.Repository) string {
+				head, err := repo.Head()
+				Expect(err).NotTo(HaveOccurred())
+				return head.Hash().String()
+			}
+
+			It("should fast-forward a clean checkout", func() {
+				checkout, err := git.PlainClone(checkoutPath, false, &git.CloneOptions{URL: remoteURL})
+				Expect(err).NotTo(HaveOccurred())
+				commitFile(remote, "README.md", "second", "me@example.com")
+
+				Expect((&dockerExtractor{Path: checkoutPath, URL: remoteURL}).Init(context.Background())).To(Succeed())
+				Expect(getHead(checkout)).To(Equal(getHead(remote)))
+			})
+
+			It("should keep local changes", func() {
+				_, err := git.PlainClone(checkoutPath, false, &git.CloneOptions{URL: remoteURL})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(checkoutPath, "README.md"), []byte("local"), 0600)).To(Succeed())
+				commitFile(remote, "README.md", "second", "me@example.com")
+
+				Expect((&dockerExtractor{Path: checkoutPath, URL: remoteURL}).Init(context.Background())).To(Succeed())
+				content, err := ioutil.ReadFile(filepath.Join(checkoutPath, "README.md"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal("local"))
+			})
+
+			It("should keep diverged checkouts", func() {
+				checkout, err := git.PlainClone(checkoutPath, false, &git.CloneOptions{URL: remoteURL})
+				Expect(err).NotTo(HaveOccurred())
+				commitFile(checkout, "README.md", "local", "me@example.com")
+				localHead := getHead(checkout)
+				commitFile(remote, "README.md", "second", "me@example.com")
+
+				Expect((&dockerExtractor{Path: checkoutPath, URL: remoteURL}).Init(context.Background())).To(Succeed())
+				Expect(getHead(checkout)).To(Equal(localHead))
+			})
+
+			It("should keep folders which aren't clones", func() {
+				Expect(os.Mkdir(checkoutPath, 0700)).To(Succeed())
+				scriptPath := filepath.Join(checkoutPath, "run-docker-headless.sh")
+				Expect(ioutil.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0700)).To(Succeed())
+
+				Expect((&dockerExtractor{Path: checkoutPath, URL: remoteURL}).Init(context.Background())).To(Succeed())
+				Expect(scriptPath).To(BeAnExistingFile())
+			})
+
+			It("should clone a missing checkout", func() {
+				Expect((&dockerExtractor{Path: checkoutPath, URL: remoteURL}).Init(context.Background())).To(Succeed())
+				Expect(filepath.Join(checkoutPath, "README.md")).To(BeAnExistingFile())
+			})
+		})
+
+		It("should run the script in the repo_info_extractor folder and move its result to the output folder", func() {
+			extractor := &dockerExtractor{Path: tmpPath}
+			Expect(ioutil.WriteFile(extractor.getScriptPath(), []byte("#!/bin/sh\npwd > repo_data.json.zip\n"), 0700)).To(Succeed())
+			outputPath := filepath.Join(tmpPath, "output")
+			Expect(os.Mkdir(outputPath, 0700)).To(Succeed())
+
+			Expect(extractor.Extract(context.Background(), "/tmp/myrepo", outputPath, []string{"me@example.com"})).To(Succeed())
+			content, err := ioutil.ReadFile(filepath.Join(outputPath, resultFileName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(tmpPath + "\n"))
+			Expect(filepath.Join(tmpPath, resultFileName)).NotTo(BeAnExistingFile())
+		})
+
+		It("should remove the container of the script when the extraction is stopped", func() {
+			extractor := &dockerExtractor{Path: tmpPath}
+			Expect(ioutil.WriteFile(extractor.getScriptPath(), []byte("#!/bin/sh\nsleep 10\n"), 0700)).To(Succeed())
+			outputPath := filepath.Join(tmpPath, "output")
+			Expect(os.Mkdir(outputPath, 0700)).To(Succeed())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			Expect(extractor.Extract(ctx, "/tmp/myrepo", outputPath, []string{"me@example.com"})).NotTo(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(tmpPath, "bin", "docker.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal("ps --all --quiet --filter volume=/tmp/myrepo\nrm --force container-id\n"))
+		})
+	})
+
+})
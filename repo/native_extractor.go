@@ -0,0 +1,336 @@
+package repo
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// nativeExtractor walks the history of the repository with go-git and produces
+// the same result as repo_info_extractor, without docker or any external tool.
+type nativeExtractor struct{}
+
+func (e *nativeExtractor) Init(ctx context.Context) error {
+	return nil
+}
+
+func (e *nativeExtractor) Extract(ctx context.Context, repoPath, outputPath string, emails []string) error {
+	repository, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return err
+	}
+
+	result := repoAnalysisResult{
+		RepoName: filepath.Base(repoPath),
+		Commits:  make([]commit, 0),
+	}
+	result.Remotes.Origin = getOriginURL(repository)
+	result.PrimaryRemoteURL = result.Remotes.Origin
+	result.NumberOfBranches, result.NumberOfTags, err = countReferences(repository)
+	if err != nil {
+		return err
+	}
+
+	hashedEmails := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		hashedEmails[md5Hash(email)] = true
+	}
+	localUsernames := make(map[string]bool)
+	authorEmails := make(map[string]bool)
+
+	err = walkCommits(repository, func(c *object.Commit, shallow bool) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		extractedCommit, err := extractCommit(c, shallow)
+		if err != nil {
+			return err
+		}
+		result.Commits = append(result.Commits, extractedCommit)
+		authorEmails[extractedCommit.AuthorEmail] = true
+		if hashedEmails[extractedCommit.AuthorEmail] {
+			localUsernames[extractedCommit.AuthorName] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	result.LocalUsernames = getSortedKeys(localUsernames)
+	result.EmailsV2 = getSortedKeys(authorEmails)
+
+	return writeResult(filepath.Join(outputPath, resultFileName), &result)
+}
+
+func extractCommit(c *object.Commit, shallow bool) (commit, error) {
+	extractedCommit := commit{
+		AuthorName: c.Author.Name,
+		// Emails are never uploaded in plain text
+		AuthorEmail:  md5Hash(c.Author.Email),
+		CreatedAt:    c.Author.When.Format("2006-01-02 15:04:05 -0700"),
+		CommitHash:   c.Hash.String(),
+		IsMerge:      c.NumParents() > 1,
+		Parents:      make([]string, 0, c.NumParents()),
+		ChangedFiles: make([]changedFile, 0),
+	}
+	for _, parent := range c.ParentHashes {
+		extractedCommit.Parents = append(extractedCommit.Parents, parent.String())
+	}
+	// Changes of merge commits are already counted in their parents.
+	// Parents of shallow commits are not cloned, so their changes can't be calculated.
+	if extractedCommit.IsMerge || shallow {
+		return extractedCommit, nil
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		return extractedCommit, err
+	}
+	for _, stat := range stats {
+		extractedCommit.ChangedFiles = append(extractedCommit.ChangedFiles, changedFile{
+			FileName:   stat.Name,
+			Language:   getLanguage(stat.Name),
+			Insertions: stat.Addition,
+			Deletions:  stat.Deletion,
+		})
+	}
+	return extractedCommit, nil
+}
+
+// walkCommits calls fn for every commit reachable from HEAD and the references, newest first.
+// go-git can't walk the history of shallow clones, so parents of shallow commits are skipped.
+func walkCommits(repository *git.Repository, fn func(c *object.Commit, shallow bool) error) error {
+	shallowHashes, err := repository.Storer.Shallow()
+	if err != nil {
+		return err
+	}
+	shallow := make(map[plumbing.Hash]bool, len(shallowHashes))
+	for _, hash := range shallowHashes {
+		shallow[hash] = true
+	}
+
+	starts, err := getStartCommits(repository)
+	if err != nil {
+		return err
+	}
+	visited := make(map[plumbing.Hash]bool)
+	commits := make([]*object.Commit, 0)
+	for len(starts) > 0 {
+		c := starts[len(starts)-1]
+		starts = starts[:len(starts)-1]
+		if visited[c.Hash] {
+			continue
+		}
+		visited[c.Hash] = true
+		commits = append(commits, c)
+		if shallow[c.Hash] {
+			continue
+		}
+		for _, parentHash := range c.ParentHashes {
+			if visited[parentHash] {
+				continue
+			}
+			parent, err := repository.CommitObject(parentHash)
+			if err != nil {
+				return err
+			}
+			starts = append(starts, parent)
+		}
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+	for _, c := range commits {
+		err = fn(c, shallow[c.Hash])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commits pointed by HEAD, branches and tags
+func getStartCommits(repository *git.Repository) ([]*object.Commit, error) {
+	starts := make([]*object.Commit, 0)
+	head, err := repository.Head()
+	// Empty repositories don't have a HEAD
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+	if head != nil {
+		c, err := repository.CommitObject(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+		starts = append(starts, c)
+	}
+
+	references, err := repository.References()
+	if err != nil {
+		return nil, err
+	}
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		if reference.Type() != plumbing.HashReference {
+			return nil
+		}
+		c, err := repository.CommitObject(reference.Hash())
+		if err == nil {
+			starts = append(starts, c)
+			return nil
+		}
+		// Annotated tags point to tag objects
+		tag, err := repository.TagObject(reference.Hash())
+		if err != nil {
+			return nil
+		}
+		c, err = tag.Commit()
+		if err == nil {
+			starts = append(starts, c)
+		}
+		return nil
+	})
+	return starts, err
+}
+
+// Origin url without credentials
+func getOriginURL(repository *git.Repository) string {
+	remote, err := repository.Remote(git.DefaultRemoteName)
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	originURL, err := url.Parse(remote.Config().URLs[0])
+	if err != nil {
+		// scp like ssh urls (git@github.com:user/repo.git) can't be parsed but don't have credentials
+		return remote.Config().URLs[0]
+	}
+	originURL.User = nil
+	return originURL.String()
+}
+
+// Branches are counted once even if they exist both locally and on the remote
+func countReferences(repository *git.Repository) (int, int, error) {
+	branches := make(map[string]bool)
+	tags := 0
+	references, err := repository.References()
+	if err != nil {
+		return 0, 0, err
+	}
+	err = references.ForEach(func(reference *plumbing.Reference) error {
+		name := reference.Name()
+		if name.IsBranch() {
+			branches[name.Short()] = true
+		} else if name.IsRemote() && !strings.HasSuffix(name.String(), "/HEAD") {
+			// refs/remotes/origin/master -> master
+			branches[strings.SplitN(name.Short(), "/", 2)[1]] = true
+		} else if name.IsTag() {
+			tags++
+		}
+		return nil
+	})
+	return len(branches), tags, err
+}
+
+func writeResult(path string, result *repoAnalysisResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zipWriter := zip.NewWriter(file)
+	writer, err := zipWriter.Create("repo_data.json")
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(writer).Encode(result)
+	if err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
+
+func getSortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func getLanguage(fileName string) string {
+	if language, ok := languagesByFileName[strings.ToLower(filepath.Base(fileName))]; ok {
+		return language
+	}
+	return languagesByExtension[strings.ToLower(filepath.Ext(fileName))]
+}
+
+var languagesByFileName = map[string]string{
+	"dockerfile":     "Dockerfile",
+	"makefile":       "Makefile",
+	"cmakelists.txt": "CMake",
+}
+
+var languagesByExtension = map[string]string{
+	".c":      "C",
+	".h":      "C",
+	".cc":     "C++",
+	".cpp":    "C++",
+	".cxx":    "C++",
+	".hpp":    "C++",
+	".cs":     "C#",
+	".clj":    "Clojure",
+	".coffee": "CoffeeScript",
+	".css":    "CSS",
+	".dart":   "Dart",
+	".ex":     "Elixir",
+	".exs":    "Elixir",
+	".elm":    "Elm",
+	".erl":    "Erlang",
+	".fs":     "F#",
+	".go":     "Go",
+	".groovy": "Groovy",
+	".hs":     "Haskell",
+	".html":   "HTML",
+	".htm":    "HTML",
+	".java":   "Java",
+	".js":     "JavaScript",
+	".jsx":    "JavaScript",
+	".mjs":    "JavaScript",
+	".kt":     "Kotlin",
+	".kts":    "Kotlin",
+	".less":   "Less",
+	".lua":    "Lua",
+	".m":      "Objective-C",
+	".mm":     "Objective-C",
+	".php":    "PHP",
+	".pl":     "Perl",
+	".pm":     "Perl",
+	".ps1":    "PowerShell",
+	".py":     "Python",
+	".r":      "R",
+	".rb":     "Ruby",
+	".rs":     "Rust",
+	".scala":  "Scala",
+	".scss":   "SCSS",
+	".sass":   "Sass",
+	".sh":     "Shell",
+	".bash":   "Shell",
+	".sql":    "SQL",
+	".swift":  "Swift",
+	".tf":     "HCL",
+	".ts":     "TypeScript",
+	".tsx":    "TypeScript",
+	".vb":     "Visual Basic",
+	".vue":    "Vue",
+}
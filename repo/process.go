@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// Time the extractor has to stop after it is asked to, before it is killed
+const processStopTimeout = 10 * time.Second
+
+// Runs the command and stops it with all of its child processes (e.g. docker run started
+// by a script) when the context is cancelled. Returns the error of the context in that case.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	// Asked to stop first, so docker can stop its container too
+	stopProcessTree(cmd)
+	select {
+	case <-done:
+	case <-time.After(processStopTimeout):
+		killProcessTree(cmd)
+		<-done
+	}
+	return ctx.Err()
+}
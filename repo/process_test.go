@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Running commands", func() {
+
+	var tmpPath string
+
+	BeforeEach(func() {
+		var err error
+		tmpPath, err = ioutil.TempDir("", "process_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpPath)
+	})
+
+	It("should return the result of the command", func() {
+		Expect(runCommand(context.Background(), exec.Command("sh", "-c", "exit 0"))).To(Succeed())
+		Expect(runCommand(context.Background(), exec.Command("sh", "-c", "exit 1"))).NotTo(Succeed())
+	})
+
+	It("should stop the child processes when the context is cancelled", func() {
+		markerPath := filepath.Join(tmpPath, "marker")
+		// The child would outlive the shell if only the shell was killed
+		cmd := exec.Command("sh", "-c", "(sleep 1 && touch "+markerPath+") & wait")
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		Expect(runCommand(ctx, cmd)).To(Equal(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Consistently(markerPath, 2*time.Second).ShouldNot(BeAnExistingFile())
+	})
+
+})
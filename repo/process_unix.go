@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package repo
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Child processes are started in the process group of the command, so they can be stopped together
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func stopProcessTree(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcessTree(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,13 @@
+package repo
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestRepo(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Repo Suite")
+}
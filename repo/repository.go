@@ -2,67 +2,149 @@ package repo
 
 import (
 	"archive/zip"
-	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/gookit/color"
 
 	"github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
+)
+
+// repoOutcome is the result of processing a single repository
+type repoOutcome int
+
+const (
+	// outcomeInterrupted is the zero value, repositories which weren't started because of cancellation have it too
+	outcomeInterrupted repoOutcome = iota
+	outcomeSucceeded
+	outcomeFailed
+	outcomeTimedOut
 )
 
 // RepositoryService handles repository operations like cloning, updating and processing repos
 type RepositoryService interface {
-	ProcessRepos(repos []*entity.Repository) []*entity.Repository
+	// ProcessRepos stops when the context is cancelled, interrupted repositories are rolled back
+	ProcessRepos(ctx context.Context, repos []*entity.Repository) []*entity.Repository
 	GetTotalRepos() int
 	GetRemainingRepos() int
-	GetCurrentRepo() *entity.Repository
+	// GetCurrentRepos returns the repositories which are being processed right now
+	GetCurrentRepos() []*entity.Repository
+	RemoveOrphans(repos []*entity.Repository, providers []string) error
 }
 
 type repositoryService struct {
-	RepoInfoExtractorPath string
-	RepoInfoExtractorURL  string
-	ProviderName          string
-	RepoVisibility        string
-	Username              string
-	Token                 string
-	Emails                []string
-	HashedEmails          map[string]interface{}
-	SaveRepoPath          string
-	AppPath               string
-	TotalRepos            int
-	ProcessedRepos        int
-	CurrentRepository     *entity.Repository
+	Extractor Extractor
+	State     *state.Store
+	// Journal is the progress of the current run
+	Journal *state.Journal
+	Force   bool
+	// SSHAuth is set when repositories are cloned with SSH
+	SSHAuth       transport.AuthMethod
+	SSHFallback   bool
+	CloneStrategy cloneStrategy
+	Cleanup       cleanupOptions
+	Providers     map[string]config.ProviderConfig
+	Emails        []string
+	HashedEmails  map[string]interface{}
+	SaveRepoPath  string
+	ResultPath    string
+	Concurrency   int
+	// CloneTimeout and ExtractTimeout limit the time spent on a single repository, 0 means no limit
+	CloneTimeout   time.Duration
+	ExtractTimeout time.Duration
+	// CloneRetry is used when cloning fails because of network or server errors
+	CloneRetry          retry.Policy
+	TotalRepos          int
+	ProcessedRepos      int
+	CurrentRepositories map[string]*entity.Repository
+	// mutex guards TotalRepos, ProcessedRepos and CurrentRepositories
+	mutex sync.Mutex
 }
 
 // NewRepositoryService constructor
-func NewRepositoryService(c config.Config) RepositoryService {
-	saveRepoPath := getSaveRepoPath(c.AppPath)
+func NewRepositoryService(c config.Config, store *state.Store, journal *state.Journal) RepositoryService {
+	extractor, err := NewExtractor(c)
+	if err != nil {
+		log.Fatal(err)
+	}
 	repositoryService := &repositoryService{
-		RepoInfoExtractorPath: c.RepoInfoExtractorPath,
-		RepoInfoExtractorURL:  "https://github.com/codersrank-org/repo_info_extractor",
-		ProviderName:          c.ProviderName,
-		RepoVisibility:        c.RepoVisibility,
-		Token:                 c.Token,
-		Emails:                c.Emails,
-		SaveRepoPath:          saveRepoPath,
-		AppPath:               c.AppPath,
-	}
-
-	if c.Username == "" {
-		// default username to "git"
-		repositoryService.Username = "git"
-	} else {
-		repositoryService.Username = c.Username
+		Extractor: extractor,
+		State:     store,
+		Journal:   journal,
+		Force:     c.Force,
+		CloneStrategy: cloneStrategy{
+			Name:  c.CloneStrategy,
+			Depth: c.CloneDepth,
+			Since: c.CloneSince,
+		},
+		Cleanup: cleanupOptions{
+			DeleteAfterProcessing: c.DeleteClones,
+			KeepClones:            c.KeepClones,
+			MaxSize:               c.MaxCloneSize,
+		},
+		Providers:           make(map[string]config.ProviderConfig, len(c.Providers)),
+		Emails:              c.Emails,
+		SaveRepoPath:        c.WorkspacePath,
+		ResultPath:          c.ResultsPath,
+		Concurrency:         c.Concurrency,
+		CloneTimeout:        c.CloneTimeout,
+		ExtractTimeout:      c.ExtractTimeout,
+		CloneRetry:          retry.ClonePolicy,
+		CurrentRepositories: make(map[string]*entity.Repository),
+	}
+	if repositoryService.Concurrency < 1 {
+		repositoryService.Concurrency = 1
+	}
+
+	if c.CloneProtocol == "ssh" {
+		repositoryService.SSHAuth, err = newSSHAuth(c.SSHKey, c.SSHKeyPassphrase, c.KnownHosts)
+		if err != nil {
+			log.Fatalf("Couldn't initialize SSH authentication: %s", err.Error())
+		}
+		repositoryService.SSHFallback = c.SSHFallback
+	}
+
+	caCerts := make([]string, 0)
+	for _, providerConfig := range c.Providers {
+		// Clones in the workspace can be deleted, local repositories must never be there
+		for _, path := range providerConfig.Paths {
+			if isInside(c.WorkspacePath, path) {
+				log.Fatalf("Local path %s is inside the workspace folder %s, which is used for clones.", path, c.WorkspacePath)
+			}
+		}
+		if providerConfig.CACert != "" {
+			caCerts = append(caCerts, providerConfig.CACert)
+		}
+		if providerConfig.Username == "" {
+			providerConfig.Username = getDefaultUsername(providerConfig.ProviderName)
+		}
+		repositoryService.Providers[providerConfig.Name] = providerConfig
+	}
+	// go-git has a single HTTPS client, it trusts the CAs of every provider
+	if len(caCerts) > 0 {
+		httpClient, err := config.NewHTTPClient(caCerts...)
+		if err != nil {
+			log.Fatalf("Couldn't load CA bundles: %s", err.Error())
+		}
+		client.InstallProtocol("https", http.NewClient(httpClient))
 	}
 
 	hashedEmails := make(map[string]interface{}, len(c.Emails))
@@ -70,88 +152,372 @@ func NewRepositoryService(c config.Config) RepositoryService {
 		hashedEmails[md5Hash(email)] = nil
 	}
 	repositoryService.HashedEmails = hashedEmails
-	repositoryService.initRepoInfoExtractor()
 	return repositoryService
 }
 
 func (r *repositoryService) GetTotalRepos() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	return r.TotalRepos
 }
 
 func (r *repositoryService) GetRemainingRepos() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	return r.TotalRepos - r.ProcessedRepos
 }
 
-func (r *repositoryService) GetCurrentRepo() *entity.Repository {
-	return r.CurrentRepository
+func (r *repositoryService) GetCurrentRepos() []*entity.Repository {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	repos := make([]*entity.Repository, 0, len(r.CurrentRepositories))
+	for _, repo := range r.CurrentRepositories {
+		repos = append(repos, repo)
+	}
+	return repos
 }
 
-func (r *repositoryService) ProcessRepos(repos []*entity.Repository) []*entity.Repository {
+// ProcessRepos clones and processes repos with a pool of Concurrency workers.
+// Returned list keeps the order of the given repos.
+func (r *repositoryService) ProcessRepos(ctx context.Context, repos []*entity.Repository) []*entity.Repository {
+	// Extractor is initialized here, other commands (e.g. clean) don't need it
+	err := r.Extractor.Init(ctx)
+	if err != nil {
+		log.Fatalf("Couldn't initialize extractor: %s", err.Error())
+	}
+
+	r.mutex.Lock()
 	r.TotalRepos = len(repos)
+	r.ProcessedRepos = 0
+	r.mutex.Unlock()
+
+	outcomes := make([]repoOutcome, len(repos))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < r.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				fmt.Printf("Extracting %s (%d/%d)\n", color.Info.Sprint(repos[index].Name), index+1, len(repos))
+				outcomes[index] = r.processRepo(ctx, repos[index])
+			}
+		}()
+	}
+	// Repositories aren't started after cancellation, only the running ones are waited for
+jobLoop:
+	for index := range repos {
+		select {
+		case jobs <- index:
+		case <-ctx.Done():
+			break jobLoop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
 	processedRepos := make([]*entity.Repository, 0, len(repos))
-	for _, repo := range repos {
+	for index, repo := range repos {
+		if outcomes[index] == outcomeSucceeded {
+			processedRepos = append(processedRepos, repo)
+		}
+	}
+	printSummary(repos, outcomes)
+	return processedRepos
+}
+
+// Timed out repositories are listed, so they can be checked or processed with longer timeouts
+func printSummary(repos []*entity.Repository, outcomes []repoOutcome) {
+	counts := make(map[repoOutcome]int)
+	timedOut := make([]string, 0)
+	for index, outcome := range outcomes {
+		counts[outcome]++
+		if outcome == outcomeTimedOut {
+			timedOut = append(timedOut, repos[index].FullName)
+		}
+	}
+	fmt.Printf("Processed %d repositories: %d succeeded, %d failed, %d timed out",
+		len(repos), counts[outcomeSucceeded], counts[outcomeFailed], counts[outcomeTimedOut])
+	if counts[outcomeInterrupted] > 0 {
+		fmt.Printf(", %d interrupted", counts[outcomeInterrupted])
+	}
+	fmt.Println()
+	for _, name := range timedOut {
+		fmt.Printf("Timed out: %s\n", color.Warn.Sprint(name))
+	}
+}
+
+func (r *repositoryService) processRepo(ctx context.Context, repo *entity.Repository) repoOutcome {
+	r.mutex.Lock()
+	r.CurrentRepositories[repo.UniqueID()] = repo
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		delete(r.CurrentRepositories, repo.UniqueID())
 		r.ProcessedRepos++
-		r.CurrentRepository = repo
-		fmt.Printf("Extracting %s (%d/%d)\n", color.Info.Sprint(repo.Name), r.ProcessedRepos, len(repos))
-		err := r.clone(repo)
+		// Limits are enforced during the run, so a long list of repositories doesn't fill the disk.
+		// Under the mutex, so other workers don't start using a clone while it is deleted.
+		err := r.enforceCloneLimits(r.getClonesInUse())
 		if err != nil {
-			fmt.Printf("Couldn't clone repo. Error: %s\n", color.Danger.Sprint(err.Error()))
-			continue
+			fmt.Printf("Couldn't delete least recently used clones. Error: %s\n", color.Warn.Sprint(err.Error()))
+		}
+	}()
+
+	// Resumed runs don't extract the repositories again which were extracted before the interruption
+	if r.Journal.Reached(repo.UniqueID(), state.StageExtracted) {
+		if _, err := os.Stat(r.getResultPath(repo)); err == nil {
+			fmt.Printf("%s was extracted before the interruption, skipping\n", color.Info.Sprint(repo.FullName))
+			return outcomeSucceeded
 		}
-		err = r.process(repo)
+	}
+
+	outcome := r.cloneAndProcess(ctx, repo)
+	if outcome != outcomeSucceeded {
+		return outcome
+	}
+	err := r.Journal.SetStage(repo.UniqueID(), state.StageExtracted)
+	if err != nil {
+		fmt.Printf("Couldn't save progress of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(err.Error()))
+	}
+	// Local repositories aren't clones, they are never deleted
+	if repo.LocalPath != "" {
+		return outcomeSucceeded
+	}
+	if r.Cleanup.DeleteAfterProcessing {
+		err = r.deleteClone(repo)
+	} else {
+		err = r.touchClone(repo)
+	}
+	if err != nil {
+		fmt.Printf("Couldn't clean up clone of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(err.Error()))
+	}
+	return outcomeSucceeded
+}
+
+func (r *repositoryService) cloneAndProcess(ctx context.Context, repo *entity.Repository) repoOutcome {
+	// Local repositories are extracted where they are
+	if repo.LocalPath == "" {
+		cloneCtx, cancel := withTimeout(ctx, r.CloneTimeout)
+		result, err := r.clone(cloneCtx, repo)
+		cancel()
 		if err != nil {
-			fmt.Printf("Couldn't process repo. Error: %s\n", color.Danger.Sprint(err.Error()))
-			continue
+			return r.stepFailed(ctx, cloneCtx, repo, "clone", err)
+		}
+		if result.Reason != nil {
+			fmt.Printf("%s was %s. Reason: %s\n", repo.FullName, result.Status, color.Warn.Sprint(r.scrub(result.Reason)))
+		} else {
+			fmt.Printf("%s is %s\n", repo.FullName, result.Status)
 		}
-		processedRepos = append(processedRepos, repo)
 	}
-	return processedRepos
+	err := r.Journal.SetStage(repo.UniqueID(), state.StageCloned)
+	if err != nil {
+		fmt.Printf("Couldn't save progress of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(err.Error()))
+	}
+	head, err := getHead(r.getSourcePath(repo))
+	if err != nil {
+		fmt.Printf("Couldn't read HEAD of %s. Error: %s\n", repo.FullName, color.Danger.Sprint(r.scrub(err)))
+		r.setFailed(repo)
+		return outcomeFailed
+	}
+	if !r.Force && r.isUpToDate(repo, head) {
+		fmt.Printf("%s hasn't changed since the last run, skipping extraction\n", color.Info.Sprint(repo.FullName))
+		return outcomeSucceeded
+	}
+	extractCtx, cancel := withTimeout(ctx, r.ExtractTimeout)
+	err = r.process(extractCtx, repo)
+	cancel()
+	if err != nil {
+		return r.stepFailed(ctx, extractCtx, repo, "process", err)
+	}
+
+	checksum, err := state.Checksum(r.getResultPath(repo))
+	if err == nil {
+		err = r.State.SetProcessed(repo.UniqueID(), head, checksum, state.HashEmails(r.Emails))
+	}
+	if err != nil {
+		// Result is fine, it will only be extracted again next time
+		fmt.Printf("Couldn't save state of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(r.scrub(err)))
+	}
+	return outcomeSucceeded
+}
+
+// Tells interruptions (ctx is cancelled) and timeouts (only stepCtx is cancelled) apart from other errors
+func (r *repositoryService) stepFailed(ctx, stepCtx context.Context, repo *entity.Repository, step string, err error) repoOutcome {
+	if ctx.Err() != nil {
+		fmt.Printf("%s was interrupted and rolled back\n", color.Info.Sprint(repo.FullName))
+		return outcomeInterrupted
+	}
+	if stepCtx.Err() == context.DeadlineExceeded {
+		fmt.Printf("Couldn't %s %s. Error: %s\n", step, repo.FullName, color.Danger.Sprint("timed out"))
+		return outcomeTimedOut
+	}
+	fmt.Printf("Couldn't %s %s. Error: %s\n", step, repo.FullName, color.Danger.Sprint(r.scrub(err)))
+	// Extraction fails the same way until the repository changes (e.g. none of the emails are in it),
+	// so it doesn't keep the run unfinished. Network errors of clones can be retried by resuming.
+	if step == "process" || !isTemporaryCloneError(err) {
+		r.setFailed(repo)
+	}
+	return outcomeFailed
+}
+
+func (r *repositoryService) setFailed(repo *entity.Repository) {
+	err := r.Journal.SetStage(repo.UniqueID(), state.StageFailed)
+	if err != nil {
+		fmt.Printf("Couldn't save progress of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(err.Error()))
+	}
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (r *repositoryService) initRepoInfoExtractor() {
-	err := cloneRepository(r.RepoInfoExtractorURL, r.RepoInfoExtractorPath, "Repo Info Extractor")
+// Repository is up to date if neither HEAD nor the emails have changed and the previous result is still there
+func (r *repositoryService) isUpToDate(repo *entity.Repository, head string) bool {
+	repositoryState, ok := r.State.Get(repo.UniqueID())
+	if !ok || repositoryState.Head != head || repositoryState.Emails != state.HashEmails(r.Emails) {
+		return false
+	}
+	checksum, err := state.Checksum(r.getResultPath(repo))
+	return err == nil && checksum == repositoryState.Checksum
+}
+
+func (r *repositoryService) clone(ctx context.Context, repo *entity.Repository) (cloneResult, error) {
+	if r.SSHAuth != nil && repo.SSHURL != "" {
+		result, err := r.cloneWithRetry(ctx, repo, repo.SSHURL, r.SSHAuth)
+		if err == nil || !r.SSHFallback || ctx.Err() != nil {
+			return result, err
+		}
+		fmt.Printf("Couldn't clone %s with SSH, falling back to HTTPS. Error: %s\n", repo.FullName, color.Warn.Sprint(r.scrub(err)))
+	}
+
+	repoURL, err := r.getCloneURL(repo)
 	if err != nil {
-		log.Fatalf("Couldn't clone repo_info_extractor: %s", err.Error())
+		return cloneResult{}, err
+	}
+	providerConfig := r.Providers[repo.Provider]
+	auth := &http.BasicAuth{
+		Username: providerConfig.Username,
+		Password: providerConfig.Token,
+	}
+	return r.cloneWithRetry(ctx, repo, repoURL, auth)
+}
+
+// Network and server errors are retried, there is no point in retrying rejected credentials or missing repositories
+func (r *repositoryService) cloneWithRetry(ctx context.Context, repo *entity.Repository, repoURL string, auth transport.AuthMethod) (cloneResult, error) {
+	var result cloneResult
+	attempt := 0
+	err := retry.Do(ctx, r.CloneRetry, func() error {
+		var err error
+		attempt++
+		result, err = cloneRepository(ctx, repoURL, r.getRepoPath(repo), repo.FullName, auth, r.CloneStrategy, repo.DefaultBranch)
+		if err == nil || ctx.Err() != nil || !isTemporaryCloneError(err) {
+			return retry.Permanent(err)
+		}
+		if attempt >= r.CloneRetry.MaxAttempts {
+			return err
+		}
+		fmt.Printf("Couldn't clone %s, retrying. Error: %s\n", repo.FullName, color.Warn.Sprint(r.scrub(err)))
+		return err
+	})
+	return result, err
+}
+
+// Path the extractor reads the repository from, the clone or the local repository
+func (r *repositoryService) getSourcePath(repo *entity.Repository) string {
+	if repo.LocalPath != "" {
+		return repo.LocalPath
 	}
+	return r.getRepoPath(repo)
 }
 
-func (r *repositoryService) clone(repo *entity.Repository) error {
-	repoURL := fmt.Sprintf("https://%s:%s@%s/%s", r.Username, r.Token, r.ProviderName, repo.FullName)
-	repoPath := r.SaveRepoPath + "/" + repo.FullName
-	err := cloneRepository(repoURL, repoPath, repo.FullName)
-	return err
+// Clones are grouped by provider, the same FullName can exist on multiple providers
+func (r *repositoryService) getRepoPath(repo *entity.Repository) string {
+	return r.SaveRepoPath + "/" + repo.Provider + "/" + repo.FullName
 }
 
-func (r *repositoryService) process(repo *entity.Repository) error {
-	scriptPath := r.getScriptPath()
-	repoPath := r.SaveRepoPath + "/" + repo.FullName
+// Providers can set their own clone url (e.g. self-managed GitLab instances),
+// otherwise it is derived from the provider name.
+// Credentials are never part of the url, they would be saved to .git/config.
+func (r *repositoryService) getCloneURL(repo *entity.Repository) (string, error) {
+	providerConfig, ok := r.Providers[repo.Provider]
+	if !ok {
+		return "", fmt.Errorf("Unknown provider %s", repo.Provider)
+	}
+	if repo.CloneURL == "" {
+		host := providerConfig.ProviderName
+		if providerConfig.CloneHost != "" {
+			host = providerConfig.CloneHost
+		}
+		return fmt.Sprintf("https://%s/%s", host, repo.FullName), nil
+	}
+	cloneURL, err := url.Parse(repo.CloneURL)
+	if err != nil {
+		return "", err
+	}
+	cloneURL.User = nil
+	if providerConfig.CloneHost != "" {
+		cloneURL.Host = providerConfig.CloneHost
+	}
+	return cloneURL.String(), nil
+}
 
-	// Need to chdir to execute scripts because of docker
-	os.Chdir(r.RepoInfoExtractorPath)
-	cmd := exec.Command(scriptPath, repoPath, "--email="+strings.Join(r.Emails, ","), "--skip_upload", "--headless")
+// Removes tokens and credentials in urls from error messages before they are printed
+func (r *repositoryService) scrub(err error) string {
+	secrets := make([]string, 0, len(r.Providers))
+	for _, providerConfig := range r.Providers {
+		secrets = append(secrets, providerConfig.Token)
+	}
+	return scrubSecrets(err.Error(), secrets)
+}
 
-	// We can use these to print repo_info_extractor output to the screen.
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
+// GitLab expects "oauth2" as username when cloning with a token, others are fine with "git"
+func getDefaultUsername(providerName string) string {
+	if providerName == "gitlab.com" {
+		return "oauth2"
+	}
+	return "git"
+}
 
-	err := cmd.Run()
+func (r *repositoryService) process(ctx context.Context, repo *entity.Repository) error {
+	// Extractors run in the job folder, relative paths would point into it
+	repoPath, err := filepath.Abs(r.getSourcePath(repo))
 	if err != nil {
-		return errors.New(stderr.String())
+		return err
+	}
+	// Every job gets its own output folder so extractions can run in parallel.
+	// It is created inside the results folder so the result can be moved with an atomic rename.
+	jobPath, err := ioutil.TempDir(r.ResultPath, ".job-"+repo.UniqueID()+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(jobPath)
+	jobPath, err = filepath.Abs(jobPath)
+	if err != nil {
+		return err
 	}
-	// Move result to results folder
-	sourceLocation := r.RepoInfoExtractorPath + "/repo_data.json.zip"
-	targetLocation := getSaveResultPath(r.AppPath) + "/" + repo.ID + ".zip"
 
-	err = os.Rename(sourceLocation, targetLocation)
+	err = r.Extractor.Extract(ctx, repoPath, jobPath, r.Emails)
 	if err != nil {
 		return err
 	}
+	sourceLocation := jobPath + "/" + resultFileName
 
 	// Check if provided emails are present in the repo
-	err = r.checkEmails(targetLocation, repo.FullName)
-	return err
+	err = r.checkEmails(sourceLocation, repo.FullName)
+	if err != nil {
+		return err
+	}
+
+	// Move result to results folder
+	return os.Rename(sourceLocation, r.getResultPath(repo))
+}
+
+func (r *repositoryService) getResultPath(repo *entity.Repository) string {
+	return r.ResultPath + "/" + repo.UniqueID() + ".zip"
 }
 
 // Show user a warning if none of the provided emails found in the repository
@@ -200,62 +566,16 @@ func md5Hash(s string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-// TODO handle windows (.bat files)
-func (r *repositoryService) getScriptPath() string {
-	return r.RepoInfoExtractorPath + "/run-docker-headless.sh"
-}
-
-// Clone repository from given url to given path
-func cloneRepository(url, path, name string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		_, err := git.PlainClone(path, false, &git.CloneOptions{
-			URL: url,
-			//Prognress: os.Stdout,
-			// TODO add verbose flag to show/hide these.
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		// If exists, pull latest changes
-		repo, err := git.PlainOpen(path)
-		if err != nil {
-			return err
-		}
-		workTree, err := repo.Worktree()
-		if err != nil {
-			return err
-		}
-		err = workTree.Pull(&git.PullOptions{RemoteName: "origin"})
-		if err != nil && !strings.Contains(err.Error(), "already up-to-date") && !strings.Contains(err.Error(), "worktree contains unstaged changes") {
-			return err
-		}
-	}
-	return nil
-}
-
-func getAppPath() string {
-	appPath, err := os.Getwd()
+func getHead(path string) (string, error) {
+	repo, err := git.PlainOpen(path)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	return appPath
-}
-
-func getSaveRepoPath(appPath string) string {
-	tmpPath := appPath + "/tmp"
-	if _, err := os.Stat(tmpPath); os.IsNotExist(err) {
-		os.Mkdir(tmpPath, 0700)
-	}
-	return tmpPath
-}
-
-func getSaveResultPath(appPath string) string {
-	resultPath := appPath + "/results"
-	if _, err := os.Stat(resultPath); os.IsNotExist(err) {
-		os.Mkdir(resultPath, 0700)
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
 	}
-	return resultPath
+	return head.Hash().String(), nil
 }
 
 type repoAnalysisResult struct {
@@ -264,23 +584,27 @@ type repoAnalysisResult struct {
 	Remotes        struct {
 		Origin string `json:"origin"`
 	} `json:"remotes"`
-	PrimaryRemoteURL string `json:"primaryRemoteUrl"`
-	NumberOfBranches int    `json:"numberOfBranches"`
-	NumberOfTags     int    `json:"numberOfTags"`
-	Commits          []struct {
-		AuthorName   string   `json:"authorName"`
-		AuthorEmail  string   `json:"authorEmail"`
-		CreatedAt    string   `json:"createdAt"`
-		CommitHash   string   `json:"commitHash"`
-		IsMerge      bool     `json:"isMerge"`
-		Parents      []string `json:"parents"`
-		ChangedFiles []struct {
-			FileName   string `json:"fileName"`
-			Language   string `json:"language"`
-			Insertions int    `json:"insertions"`
-			Deletions  int    `json:"deletions"`
-		} `json:"changedFiles"`
-		IsDuplicated bool `json:"isDuplicated"`
-	} `json:"commits"`
-	EmailsV2 []string `json:"emails_v2"`
+	PrimaryRemoteURL string   `json:"primaryRemoteUrl"`
+	NumberOfBranches int      `json:"numberOfBranches"`
+	NumberOfTags     int      `json:"numberOfTags"`
+	Commits          []commit `json:"commits"`
+	EmailsV2         []string `json:"emails_v2"`
+}
+
+type commit struct {
+	AuthorName   string        `json:"authorName"`
+	AuthorEmail  string        `json:"authorEmail"`
+	CreatedAt    string        `json:"createdAt"`
+	CommitHash   string        `json:"commitHash"`
+	IsMerge      bool          `json:"isMerge"`
+	Parents      []string      `json:"parents"`
+	ChangedFiles []changedFile `json:"changedFiles"`
+	IsDuplicated bool          `json:"isDuplicated"`
+}
+
+type changedFile struct {
+	FileName   string `json:"fileName"`
+	Language   string `json:"language"`
+	Insertions int    `json:"insertions"`
+	Deletions  int    `json:"deletions"`
 }
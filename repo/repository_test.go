@@ -0,0 +1,540 @@
+package repo
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/config"
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
+)
+
+// Fake repo_info_extractor, it copies the prepared "<repo path>.zip" into its working directory
+const fakeExtractorScript = `#!/bin/sh
+sleep 0.2
+cp "$1.zip" repo_data.json.zip
+`
+
+var _ = Describe("Repository", func() {
+
+	var appPath string
+	var service *repositoryService
+
+	BeforeEach(func() {
+		var err error
+		appPath, err = ioutil.TempDir("", "repository_test")
+		Expect(err).NotTo(HaveOccurred())
+
+		extractorPath := filepath.Join(appPath, "repo_info_extractor")
+		Expect(os.Mkdir(extractorPath, 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(extractorPath, "run-docker-headless.sh"), []byte(fakeExtractorScript), 0700)).To(Succeed())
+
+		service = &repositoryService{
+			Extractor:    &dockerExtractor{Path: extractorPath},
+			Emails:       []string{"me@example.com"},
+			HashedEmails: map[string]interface{}{md5Hash("me@example.com"): nil},
+			SaveRepoPath: filepath.Join(appPath, "tmp"),
+			ResultPath:   filepath.Join(appPath, "results"),
+		}
+		Expect(os.Mkdir(service.SaveRepoPath, 0700)).To(Succeed())
+		Expect(os.Mkdir(service.ResultPath, 0700)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(appPath)
+	})
+
+	Describe("Processing repositories", func() {
+		It("should run extractions in parallel without mixing up the results", func() {
+			workingDirectory, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+
+			repos := make([]*entity.Repository, 5)
+			for i := range repos {
+				repos[i] = &entity.Repository{ID: string(rune('a' + i)), FullName: "me/repo-" + string(rune('a'+i)), Provider: "github.com"}
+				writeFakeResult(service.getRepoPath(repos[i])+".zip", repos[i].FullName, "me@example.com")
+			}
+
+			var wg sync.WaitGroup
+			errs := make([]error, len(repos))
+			for i := range repos {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					errs[i] = service.process(context.Background(), repos[i])
+				}(i)
+			}
+			wg.Wait()
+
+			for i, repo := range repos {
+				Expect(errs[i]).NotTo(HaveOccurred())
+				result := readFakeResult(filepath.Join(appPath, "results", repo.UniqueID()+".zip"))
+				Expect(result.RepoName).To(Equal(repo.FullName))
+			}
+			// Job folders are removed, only the results are left
+			files, err := ioutil.ReadDir(filepath.Join(appPath, "results"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(files)).To(Equal(len(repos)))
+			// Working directory of the process is never changed
+			Expect(os.Getwd()).To(Equal(workingDirectory))
+		})
+
+		It("should process every repository exactly once with a pool of workers", func() {
+			var err error
+			logPath := filepath.Join(appPath, "extractor.log")
+			service.Extractor = writeLoggingExtractor(filepath.Join(appPath, "repo_info_extractor", "extractor"), logPath)
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Concurrency = 3
+			service.State, err = state.NewStore(filepath.Join(service.ResultPath, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			repos := make([]*entity.Repository, 8)
+			for i := range repos {
+				name := "app-" + string(rune('a'+i))
+				localPath := filepath.Join(appPath, "code", name)
+				local, err := git.PlainInit(localPath, false)
+				Expect(err).NotTo(HaveOccurred())
+				commitFile(local, "README.md", "content", "me@example.com")
+				repos[i] = &entity.Repository{ID: name, FullName: "code/" + name, Provider: "local", LocalPath: localPath}
+				// Extraction of the fourth repository fails, it has no prepared result
+				if i != 3 {
+					writeFakeResult(localPath+".zip", repos[i].FullName, "me@example.com")
+				}
+			}
+
+			// Repositories in progress are watched while the pool is running
+			done := make(chan struct{})
+			watched := make(chan int)
+			go func() {
+				defer GinkgoRecover()
+				maxCurrent := 0
+				for {
+					select {
+					case <-done:
+						watched <- maxCurrent
+						return
+					default:
+					}
+					if current := len(service.GetCurrentRepos()); current > maxCurrent {
+						maxCurrent = current
+					}
+					Expect(service.GetRemainingRepos()).To(BeNumerically(">=", 0))
+					time.Sleep(time.Millisecond)
+				}
+			}()
+			processedRepos := service.ProcessRepos(context.Background(), repos)
+			close(done)
+			Expect(<-watched).To(BeNumerically("<=", service.Concurrency))
+
+			Expect(processedRepos).To(Equal([]*entity.Repository{repos[0], repos[1], repos[2], repos[4], repos[5], repos[6], repos[7]}))
+			for _, repo := range processedRepos {
+				Expect(readFakeResult(service.getResultPath(repo)).RepoName).To(Equal(repo.FullName))
+			}
+			extracted := readExtractorLog(logPath)
+			Expect(extracted).To(HaveLen(len(repos)))
+			for _, repo := range repos {
+				Expect(extracted).To(ContainElement(repo.LocalPath))
+			}
+			Expect(service.GetTotalRepos()).To(Equal(len(repos)))
+			Expect(service.GetRemainingRepos()).To(Equal(0))
+			Expect(service.GetCurrentRepos()).To(BeEmpty())
+		})
+
+		It("should keep the clones within the limits during the run", func() {
+			var err error
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Concurrency = 1
+			service.Cleanup.KeepClones = 1
+			service.State, err = state.NewStore(filepath.Join(service.ResultPath, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			// Logs the number of clones in the workspace at every extraction
+			logPath := filepath.Join(appPath, "clones.log")
+			binaryPath := filepath.Join(appPath, "repo_info_extractor", "extractor")
+			script := `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		--repo_path=*) repo_path="${arg#--repo_path=}" ;;
+	esac
+done
+find "` + service.SaveRepoPath + `" -name .git | wc -l >> "` + logPath + `"
+cp "$repo_path.zip" result.zip
+`
+			Expect(ioutil.WriteFile(binaryPath, []byte(script), 0700)).To(Succeed())
+			service.Extractor = &binaryExtractor{Binary: binaryPath}
+
+			repos := make([]*entity.Repository, 4)
+			for i := range repos {
+				name := "app-" + string(rune('a'+i))
+				remotePath := filepath.Join(appPath, "remotes", name)
+				remote, err := git.PlainInit(remotePath, false)
+				Expect(err).NotTo(HaveOccurred())
+				commitFile(remote, "README.md", "content", "me@example.com")
+				repos[i] = &entity.Repository{ID: name, FullName: "me/" + name, Provider: "local", CloneURL: "file://" + remotePath}
+				writeFakeResult(service.getRepoPath(repos[i])+".zip", repos[i].FullName, "me@example.com")
+			}
+
+			Expect(service.ProcessRepos(context.Background(), repos)).To(Equal(repos))
+			// The kept clone and the one being extracted
+			Expect(readExtractorLog(logPath)).To(Equal([]string{"1", "2", "2", "2"}))
+			clones, err := findClones(service.SaveRepoPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clones).To(HaveLen(1))
+			Expect(clones[0].Path).To(Equal(filepath.Clean(service.getRepoPath(repos[3]))))
+		})
+
+		It("should work with relative folders", func() {
+			workingDirectory, err := os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chdir(appPath)).To(Succeed())
+			defer os.Chdir(workingDirectory)
+			service.SaveRepoPath = "tmp"
+			service.ResultPath = "results"
+			service.Extractor.(*dockerExtractor).Path = "repo_info_extractor"
+
+			repo := &entity.Repository{ID: "1", FullName: "me/relative", Provider: "github.com"}
+			writeFakeResult(service.getRepoPath(repo)+".zip", repo.FullName, "me@example.com")
+			Expect(service.process(context.Background(), repo)).To(Succeed())
+			Expect(readFakeResult(filepath.Join(appPath, "results", repo.UniqueID()+".zip")).RepoName).To(Equal("me/relative"))
+		})
+
+		It("should not keep the result if none of the emails found", func() {
+			repo := &entity.Repository{ID: "1", FullName: "me/other", Provider: "github.com"}
+			writeFakeResult(service.getRepoPath(repo)+".zip", repo.FullName, "someone@example.com")
+
+			err := service.process(context.Background(), repo)
+			Expect(err).To(MatchError(ContainSubstring("None of the provided emails")))
+			Expect(filepath.Join(appPath, "results", repo.UniqueID()+".zip")).NotTo(BeAnExistingFile())
+		})
+
+		It("should return the extractor error output", func() {
+			repo := &entity.Repository{ID: "2", FullName: "me/missing", Provider: "github.com"}
+			err := service.process(context.Background(), repo)
+			Expect(err).To(MatchError(ContainSubstring("me/missing.zip")))
+		})
+	})
+
+	Describe("Timeouts", func() {
+		var repo *entity.Repository
+
+		BeforeEach(func() {
+			remotePath := filepath.Join(appPath, "remote")
+			remote, err := git.PlainInit(remotePath, false)
+			Expect(err).NotTo(HaveOccurred())
+			commitFile(remote, "README.md", "content", "me@example.com")
+			repo = &entity.Repository{ID: "1", FullName: "me/remote", Provider: "local", CloneURL: "file://" + remotePath}
+			writeFakeResult(service.getRepoPath(repo)+".zip", repo.FullName, "me@example.com")
+
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Concurrency = 1
+			service.State, err = state.NewStore(filepath.Join(service.ResultPath, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.Journal.Start([]*entity.Repository{repo})).To(Succeed())
+		})
+
+		It("should process repositories within the timeouts", func() {
+			service.ExtractTimeout = 5 * time.Second
+			Expect(service.processRepo(context.Background(), repo)).To(Equal(outcomeSucceeded))
+			Expect(service.getResultPath(repo)).To(BeAnExistingFile())
+			Expect(service.Journal.Reached(repo.UniqueID(), state.StageExtracted)).To(BeTrue())
+		})
+
+		It("should stop the extractor and skip the repository when extraction times out", func() {
+			scriptPath := service.Extractor.(*dockerExtractor).getScriptPath()
+			Expect(ioutil.WriteFile(scriptPath, []byte("#!/bin/sh\nsleep 10\n"), 0700)).To(Succeed())
+			service.ExtractTimeout = 200 * time.Millisecond
+
+			start := time.Now()
+			Expect(service.processRepo(context.Background(), repo)).To(Equal(outcomeTimedOut))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(service.getResultPath(repo)).NotTo(BeAnExistingFile())
+			Expect(service.Journal.Reached(repo.UniqueID(), state.StageExtracted)).To(BeFalse())
+		})
+	})
+
+	Describe("Resuming runs", func() {
+		It("should skip repositories which were extracted before the interruption", func() {
+			repo := &entity.Repository{ID: "1", FullName: "me/extracted", Provider: "github.com"}
+			var err error
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.Journal.Start([]*entity.Repository{repo})).To(Succeed())
+			Expect(service.Journal.SetStage(repo.UniqueID(), state.StageExtracted)).To(Succeed())
+			writeFakeResult(service.getResultPath(repo), repo.FullName, "me@example.com")
+			// Neither cloning nor extracting would work
+			scriptPath := service.Extractor.(*dockerExtractor).getScriptPath()
+			Expect(ioutil.WriteFile(scriptPath, []byte("#!/bin/sh\nexit 1\n"), 0700)).To(Succeed())
+
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.processRepo(context.Background(), repo)).To(Equal(outcomeSucceeded))
+			Expect(service.getRepoPath(repo)).NotTo(BeADirectory())
+			Expect(readFakeResult(service.getResultPath(repo)).RepoName).To(Equal("me/extracted"))
+		})
+
+		It("should mark repositories which failed extraction, so they don't keep the run unfinished", func() {
+			var err error
+			logPath := filepath.Join(appPath, "extractor.log")
+			service.Extractor = writeLoggingExtractor(filepath.Join(appPath, "repo_info_extractor", "extractor"), logPath)
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Concurrency = 1
+			service.State, err = state.NewStore(filepath.Join(service.ResultPath, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			repos := make([]*entity.Repository, 2)
+			for i, name := range []string{"mine", "others"} {
+				localPath := filepath.Join(appPath, "code", name)
+				local, err := git.PlainInit(localPath, false)
+				Expect(err).NotTo(HaveOccurred())
+				commitFile(local, "README.md", "content", "me@example.com")
+				repos[i] = &entity.Repository{ID: name, FullName: "code/" + name, Provider: "local", LocalPath: localPath}
+			}
+			writeFakeResult(repos[0].LocalPath+".zip", repos[0].FullName, "me@example.com")
+			writeFakeResult(repos[1].LocalPath+".zip", repos[1].FullName, "someone@example.com")
+			Expect(service.Journal.Start(repos)).To(Succeed())
+
+			Expect(service.ProcessRepos(context.Background(), repos)).To(Equal(repos[:1]))
+			entry, _ := service.Journal.Get(repos[1].UniqueID())
+			Expect(entry.Stage).To(Equal(state.StageFailed))
+
+			// Resumed by a new process, the failed repository is tried again
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.ProcessRepos(context.Background(), service.Journal.Repos())).To(Equal(repos[:1]))
+			Expect(readExtractorLog(logPath)).To(Equal([]string{repos[0].LocalPath, repos[1].LocalPath, repos[1].LocalPath}))
+			Expect(service.Journal.SetUploaded(repos[0].UniqueID(), "token", "checksum")).To(Succeed())
+			Expect(service.Journal.Done()).To(BeTrue())
+		})
+	})
+
+	Describe("Skipping unchanged repositories", func() {
+		var repo *entity.Repository
+		var logPath string
+
+		BeforeEach(func() {
+			localPath := filepath.Join(appPath, "code", "app")
+			local, err := git.PlainInit(localPath, false)
+			Expect(err).NotTo(HaveOccurred())
+			commitFile(local, "README.md", "content", "me@example.com")
+			repo = &entity.Repository{ID: "1", FullName: "code/app", Provider: "local", LocalPath: localPath}
+			writeFakeResult(localPath+".zip", repo.FullName, "me@example.com")
+
+			logPath = filepath.Join(appPath, "extractor.log")
+			service.Extractor = writeLoggingExtractor(filepath.Join(appPath, "repo_info_extractor", "extractor"), logPath)
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Concurrency = 1
+			service.State, err = state.NewStore(filepath.Join(service.ResultPath, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not extract a repository again if its HEAD and result haven't changed", func() {
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(Equal([]*entity.Repository{repo}))
+			Expect(readExtractorLog(logPath)).To(HaveLen(1))
+			repositoryState, ok := service.State.Get(repo.UniqueID())
+			Expect(ok).To(BeTrue())
+			Expect(repositoryState.Head).NotTo(BeEmpty())
+
+			// Unchanged repositories are still uploaded, the upload skips them if their result was uploaded already
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(Equal([]*entity.Repository{repo}))
+			Expect(readExtractorLog(logPath)).To(HaveLen(1))
+		})
+
+		It("should extract a repository again when its HEAD changed", func() {
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			local, err := git.PlainOpen(repo.LocalPath)
+			Expect(err).NotTo(HaveOccurred())
+			commitFile(local, "README.md", "changed", "me@example.com")
+
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			Expect(readExtractorLog(logPath)).To(HaveLen(2))
+		})
+
+		It("should extract a repository again when the emails changed", func() {
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			service.Emails = []string{"me@example.com", "work@example.com"}
+
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			Expect(readExtractorLog(logPath)).To(HaveLen(2))
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			Expect(readExtractorLog(logPath)).To(HaveLen(2))
+		})
+
+		It("should extract unchanged repositories again when forced", func() {
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			service.Force = true
+			Expect(service.ProcessRepos(context.Background(), []*entity.Repository{repo})).To(HaveLen(1))
+			Expect(readExtractorLog(logPath)).To(HaveLen(2))
+		})
+	})
+
+	Describe("Local repositories", func() {
+		It("should extract local repositories in place and never delete them", func() {
+			localPath := filepath.Join(appPath, "code", "app")
+			local, err := git.PlainInit(localPath, false)
+			Expect(err).NotTo(HaveOccurred())
+			commitFile(local, "README.md", "content", "me@example.com")
+			repo := &entity.Repository{ID: "1", FullName: "code/app", Provider: "local", LocalPath: localPath}
+			writeFakeResult(localPath+".zip", repo.FullName, "me@example.com")
+
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CurrentRepositories = make(map[string]*entity.Repository)
+			service.Cleanup.DeleteAfterProcessing = true
+			service.State, err = state.NewStore(filepath.Join(service.ResultPath, "state.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal, err = state.NewJournal(filepath.Join(service.ResultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(service.processRepo(context.Background(), repo)).To(Equal(outcomeSucceeded))
+			Expect(readFakeResult(service.getResultPath(repo)).RepoName).To(Equal("code/app"))
+			Expect(filepath.Join(localPath, "README.md")).To(BeAnExistingFile())
+			// Nothing is cloned
+			Expect(filepath.Join(service.SaveRepoPath, "local")).NotTo(BeADirectory())
+
+			Expect(service.RemoveOrphans([]*entity.Repository{}, []string{"local"})).To(Succeed())
+			Expect(filepath.Join(localPath, "README.md")).To(BeAnExistingFile())
+		})
+
+		It("should tell if a local path is inside the workspace", func() {
+			Expect(isInside(service.SaveRepoPath, filepath.Join(service.SaveRepoPath, "local", "app"))).To(BeTrue())
+			Expect(isInside(service.SaveRepoPath, service.SaveRepoPath)).To(BeTrue())
+			Expect(isInside(service.SaveRepoPath, filepath.Join(appPath, "code"))).To(BeFalse())
+			Expect(isInside(service.SaveRepoPath, service.SaveRepoPath+"-other")).To(BeFalse())
+		})
+	})
+
+	Describe("Retrying clones", func() {
+		var server *httptest.Server
+		var requests int
+		var repo *entity.Repository
+
+		serve := func(statusCode int) {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(statusCode)
+			}))
+			repo = &entity.Repository{ID: "1", FullName: "me/remote", Provider: "local", CloneURL: server.URL + "/me/remote.git"}
+		}
+
+		BeforeEach(func() {
+			requests = 0
+			service.Providers = map[string]config.ProviderConfig{"local": {Name: "local", ProviderName: "local"}}
+			service.CloneRetry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Second}
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should retry server errors", func() {
+			serve(http.StatusServiceUnavailable)
+			_, err := service.clone(context.Background(), repo)
+			Expect(err).To(HaveOccurred())
+			Expect(requests).To(Equal(3))
+			Expect(service.getRepoPath(repo)).NotTo(BeADirectory())
+		})
+
+		It("should not retry missing repositories", func() {
+			serve(http.StatusNotFound)
+			_, err := service.clone(context.Background(), repo)
+			Expect(err).To(HaveOccurred())
+			Expect(requests).To(Equal(1))
+		})
+
+		It("should not retry rejected credentials", func() {
+			serve(http.StatusUnauthorized)
+			_, err := service.clone(context.Background(), repo)
+			Expect(err).To(HaveOccurred())
+			Expect(requests).To(Equal(1))
+		})
+	})
+
+})
+
+// Writes a zipped repo_info_extractor result with a single commit of the given author
+func writeFakeResult(path, repoName, authorEmail string) {
+	Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+	file, err := os.Create(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	var result repoAnalysisResult
+	result.RepoName = repoName
+	result.Commits = make([]commit, 1)
+	result.Commits[0].AuthorEmail = md5Hash(authorEmail)
+
+	zipWriter := zip.NewWriter(file)
+	writer, err := zipWriter.Create("repo_data.json")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(json.NewEncoder(writer).Encode(result)).To(Succeed())
+	Expect(zipWriter.Close()).To(Succeed())
+}
+
+func readFakeResult(path string) repoAnalysisResult {
+	zipReader, err := zip.OpenReader(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer zipReader.Close()
+	Expect(zipReader.File).To(HaveLen(1))
+	file, err := zipReader.File[0].Open()
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+	var result repoAnalysisResult
+	Expect(json.NewDecoder(file).Decode(&result)).To(Succeed())
+	return result
+}
+
+// Fake repo_info_extractor binary, it logs the repository paths it was run on
+// and copies the prepared "<repo path>.zip" as its result
+func writeLoggingExtractor(binaryPath, logPath string) *binaryExtractor {
+	script := `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+		--repo_path=*) repo_path="${arg#--repo_path=}" ;;
+	esac
+done
+echo "$repo_path" >> "` + logPath + `"
+cp "$repo_path.zip" result.zip
+`
+	Expect(os.MkdirAll(filepath.Dir(binaryPath), 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(binaryPath, []byte(script), 0700)).To(Succeed())
+	return &binaryExtractor{Binary: binaryPath}
+}
+
+// Repository paths the logging extractor was run on
+func readExtractorLog(logPath string) []string {
+	content, err := ioutil.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return []string{}
+	}
+	Expect(err).NotTo(HaveOccurred())
+	return strings.Fields(string(content))
+}
@@ -0,0 +1,154 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Policy describes how many times an operation is tried and how long to wait between the attempts
+type Policy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// InitialDelay is doubled after every failed attempt, up to MaxDelay
+	InitialDelay time.Duration
+	// MaxDelay is the longest wait between attempts. Errors which ask for longer waits
+	// (e.g. Retry-After of an exhausted rate limit) aren't retried.
+	MaxDelay time.Duration
+}
+
+// APIPolicy is used for the provider API requests
+var APIPolicy = Policy{MaxAttempts: 4, InitialDelay: time.Second, MaxDelay: time.Minute}
+
+// ClonePolicy is used for cloning and updating repositories
+var ClonePolicy = Policy{MaxAttempts: 3, InitialDelay: 5 * time.Second, MaxDelay: time.Minute}
+
+// UploadPolicy is used for uploading results to CodersRank
+var UploadPolicy = Policy{MaxAttempts: 5, InitialDelay: time.Second, MaxDelay: time.Minute}
+
+// permanentError is never retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// delayedError is retried after the delay asked by the server
+type delayedError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *delayedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *delayedError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error as not worth retrying (e.g. bad credentials)
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// After marks the error to be retried after the given delay (e.g. Retry-After header), instead of the backoff
+func After(err error, delay time.Duration) error {
+	if err == nil || delay <= 0 {
+		return err
+	}
+	return &delayedError{err: err, delay: delay}
+}
+
+// Do calls fn until it succeeds, returns a permanent error, runs out of attempts or the context is cancelled.
+// The last error of fn is returned without the Permanent and After marks.
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		delay := policy.backoff(attempt)
+		var delayed *delayedError
+		if errors.As(err, &delayed) {
+			err = delayed.err
+			if delayed.delay > policy.MaxDelay {
+				return err
+			}
+			delay = delayed.delay
+		}
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+var randomMutex sync.Mutex
+
+// Exponential backoff with jitter, so clients which failed together don't retry together.
+// The delay is between the half and the whole of the exponential delay.
+func (p Policy) backoff(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	randomMutex.Lock()
+	defer randomMutex.Unlock()
+	return delay/2 + time.Duration(random.Int63n(int64(delay/2)+1))
+}
+
+// ParseRetryAfter returns the delay of a Retry-After header, which is either seconds or an HTTP date.
+// Returns 0 if the header is missing or invalid.
+func ParseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// TemporaryStatus reports whether the request can succeed later with the same HTTP status code
+func TemporaryStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout || statusCode >= 500
+}
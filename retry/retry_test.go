@@ -0,0 +1,83 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+)
+
+var _ = Describe("Retry", func() {
+
+	policy := retry.Policy{MaxAttempts: 4, InitialDelay: time.Millisecond, MaxDelay: 100 * time.Millisecond}
+	errTemporary := errors.New("temporary")
+
+	// Fails the given number of times before succeeding
+	failing := func(failures int, err error) (func() error, *int) {
+		attempts := 0
+		return func() error {
+			attempts++
+			if attempts <= failures {
+				return err
+			}
+			return nil
+		}, &attempts
+	}
+
+	It("should retry until the operation succeeds", func() {
+		fn, attempts := failing(3, errTemporary)
+		Expect(retry.Do(context.Background(), policy, fn)).To(Succeed())
+		Expect(*attempts).To(Equal(4))
+	})
+
+	It("should return the last error when the attempts run out", func() {
+		fn, attempts := failing(10, errTemporary)
+		Expect(retry.Do(context.Background(), policy, fn)).To(Equal(errTemporary))
+		Expect(*attempts).To(Equal(4))
+	})
+
+	It("should not retry permanent errors", func() {
+		fn, attempts := failing(10, retry.Permanent(errTemporary))
+		Expect(retry.Do(context.Background(), policy, fn)).To(Equal(errTemporary))
+		Expect(*attempts).To(Equal(1))
+	})
+
+	It("should wait as long as the server asks", func() {
+		fn, attempts := failing(1, retry.After(errTemporary, 50*time.Millisecond))
+		start := time.Now()
+		Expect(retry.Do(context.Background(), policy, fn)).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+		Expect(*attempts).To(Equal(2))
+	})
+
+	It("should give up when the server asks for a longer wait than the maximum delay", func() {
+		fn, attempts := failing(1, retry.After(errTemporary, time.Hour))
+		Expect(retry.Do(context.Background(), policy, fn)).To(Equal(errTemporary))
+		Expect(*attempts).To(Equal(1))
+	})
+
+	It("should stop waiting when the context is cancelled", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		slowPolicy := retry.Policy{MaxAttempts: 4, InitialDelay: time.Minute, MaxDelay: time.Minute}
+		fn, attempts := failing(10, errTemporary)
+		start := time.Now()
+		Expect(retry.Do(ctx, slowPolicy, fn)).To(Equal(errTemporary))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(*attempts).To(Equal(1))
+	})
+
+	It("should parse Retry-After headers", func() {
+		now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+		Expect(retry.ParseRetryAfter("", now)).To(BeZero())
+		Expect(retry.ParseRetryAfter("120", now)).To(Equal(2 * time.Minute))
+		Expect(retry.ParseRetryAfter("Thu, 01 Oct 2020 12:00:30 GMT", now)).To(Equal(30 * time.Second))
+		Expect(retry.ParseRetryAfter("Thu, 01 Oct 2020 11:00:00 GMT", now)).To(BeZero())
+		Expect(retry.ParseRetryAfter("soon", now)).To(BeZero())
+	})
+
+})
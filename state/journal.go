@@ -0,0 +1,193 @@
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+)
+
+// Stage of a repository in the current run, stages are reached in this order
+type Stage string
+
+const (
+	StageListed    Stage = "listed"
+	StageCloned    Stage = "cloned"
+	StageExtracted Stage = "extracted"
+	StageUploaded  Stage = "uploaded"
+	// StageFailed is set when a repository can't be processed, e.g. none of the emails are found in it.
+	// It doesn't block finishing the run.
+	StageFailed Stage = "failed"
+)
+
+var stageOrder = map[Stage]int{
+	StageListed:    0,
+	StageCloned:    1,
+	StageExtracted: 2,
+	StageUploaded:  3,
+}
+
+// JournalEntry is the progress of a repository in the current run
+type JournalEntry struct {
+	Repository *entity.Repository `json:"repository"`
+	Stage      Stage              `json:"stage"`
+	// UploadToken is returned by CodersRank for the uploaded result, it is needed for merging the results.
+	// It is dropped once the result is merged.
+	UploadToken string `json:"upload_token,omitempty"`
+	// Checksum of the uploaded result, it is saved to the Store after merging the results
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Journal persists the progress of the current run, so an interrupted run can be resumed.
+// It is removed when the run finishes.
+type Journal struct {
+	path    string
+	mutex   sync.Mutex
+	entries []*JournalEntry
+	index   map[string]*JournalEntry
+}
+
+// NewJournal constructor, loads the journal of an unfinished run if it exists
+func NewJournal(path string) (*Journal, error) {
+	journal := &Journal{
+		path:    path,
+		entries: make([]*JournalEntry, 0),
+		index:   make(map[string]*JournalEntry),
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return journal, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &journal.entries)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range journal.entries {
+		journal.index[entry.Repository.UniqueID()] = entry
+	}
+	return journal, nil
+}
+
+// Unfinished reports if there is a run to resume
+func (j *Journal) Unfinished() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.entries) > 0
+}
+
+// Start begins a new run with the listed repositories, progress of the previous run is dropped
+func (j *Journal) Start(repos []*entity.Repository) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.entries = make([]*JournalEntry, len(repos))
+	j.index = make(map[string]*JournalEntry, len(repos))
+	for i, repo := range repos {
+		j.entries[i] = &JournalEntry{Repository: repo, Stage: StageListed}
+		j.index[repo.UniqueID()] = j.entries[i]
+	}
+	return j.save()
+}
+
+// Repos returns the repositories of the run in the listed order
+func (j *Journal) Repos() []*entity.Repository {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	repos := make([]*entity.Repository, len(j.entries))
+	for i, entry := range j.entries {
+		repos[i] = entry.Repository
+	}
+	return repos
+}
+
+// Get returns the progress of the repository, second value is false if the repository isn't part of the run
+func (j *Journal) Get(id string) (JournalEntry, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry, ok := j.index[id]
+	if !ok {
+		return JournalEntry{}, false
+	}
+	return *entry, true
+}
+
+// Reached reports if the repository got to the given stage
+func (j *Journal) Reached(id string, stage Stage) bool {
+	entry, ok := j.Get(id)
+	return ok && stageOrder[entry.Stage] >= stageOrder[stage]
+}
+
+// Done reports if every repository of the run is uploaded or failed, there is nothing left to resume
+func (j *Journal) Done() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, entry := range j.entries {
+		if entry.Stage != StageUploaded && entry.Stage != StageFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// SetStage saves the stage the repository got to
+func (j *Journal) SetStage(id string, stage Stage) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry, ok := j.index[id]
+	if !ok {
+		return nil
+	}
+	entry.Stage = stage
+	return j.save()
+}
+
+// SetUploaded saves the upload token and checksum of the uploaded result
+func (j *Journal) SetUploaded(id, token, checksum string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	entry, ok := j.index[id]
+	if !ok {
+		return nil
+	}
+	entry.Stage = StageUploaded
+	entry.UploadToken = token
+	entry.Checksum = checksum
+	return j.save()
+}
+
+// SetMerged drops the upload tokens of the merged results, so they aren't merged again when the run is resumed
+func (j *Journal) SetMerged(ids []string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, id := range ids {
+		if entry, ok := j.index[id]; ok {
+			entry.UploadToken = ""
+		}
+	}
+	return j.save()
+}
+
+// Finish removes the journal, there is nothing to resume after it
+func (j *Journal) Finish() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.entries = make([]*JournalEntry, 0)
+	j.index = make(map[string]*JournalEntry)
+	err := os.Remove(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (j *Journal) save() error {
+	content, err := json.MarshalIndent(j.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(j.path, content)
+}
@@ -0,0 +1,94 @@
+package state_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
+)
+
+var _ = Describe("Journal", func() {
+
+	var tmpPath, path string
+	var repos []*entity.Repository
+
+	BeforeEach(func() {
+		var err error
+		tmpPath, err = ioutil.TempDir("", "journal_test")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(tmpPath, "results", "journal.json")
+		repos = []*entity.Repository{
+			{ID: "1", FullName: "me/first", Name: "first", Provider: "github.com"},
+			{ID: "2", FullName: "me/second", Name: "second", Provider: "github.com"},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpPath)
+	})
+
+	It("should persist the progress of an interrupted run", func() {
+		journal, err := state.NewJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Unfinished()).To(BeFalse())
+
+		Expect(journal.Start(repos)).To(Succeed())
+		Expect(journal.SetStage("github.com-1", state.StageExtracted)).To(Succeed())
+		Expect(journal.SetUploaded("github.com-1", "token", "checksum")).To(Succeed())
+		Expect(journal.SetStage("github.com-2", state.StageCloned)).To(Succeed())
+
+		journal, err = state.NewJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Unfinished()).To(BeTrue())
+		Expect(journal.Repos()).To(Equal(repos))
+		entry, ok := journal.Get("github.com-1")
+		Expect(ok).To(BeTrue())
+		Expect(entry).To(Equal(state.JournalEntry{Repository: repos[0], Stage: state.StageUploaded, UploadToken: "token", Checksum: "checksum"}))
+		Expect(journal.Reached("github.com-1", state.StageExtracted)).To(BeTrue())
+		Expect(journal.Reached("github.com-2", state.StageCloned)).To(BeTrue())
+		Expect(journal.Reached("github.com-2", state.StageExtracted)).To(BeFalse())
+		Expect(journal.Reached("github.com-3", state.StageListed)).To(BeFalse())
+		Expect(journal.Done()).To(BeFalse())
+	})
+
+	It("should be done when every repository is uploaded or failed", func() {
+		journal, err := state.NewJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Start(repos)).To(Succeed())
+		Expect(journal.SetUploaded("github.com-1", "token", "checksum")).To(Succeed())
+		Expect(journal.Done()).To(BeFalse())
+		Expect(journal.SetStage("github.com-2", state.StageFailed)).To(Succeed())
+		Expect(journal.Done()).To(BeTrue())
+		Expect(journal.Reached("github.com-2", state.StageExtracted)).To(BeFalse())
+
+		Expect(journal.SetMerged([]string{"github.com-1"})).To(Succeed())
+		journal, err = state.NewJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		entry, _ := journal.Get("github.com-1")
+		Expect(entry.Stage).To(Equal(state.StageUploaded))
+		Expect(entry.UploadToken).To(BeEmpty())
+	})
+
+	It("should drop the progress when a new run starts or the run finishes", func() {
+		journal, err := state.NewJournal(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(journal.Start(repos)).To(Succeed())
+		Expect(journal.SetStage("github.com-1", state.StageExtracted)).To(Succeed())
+
+		Expect(journal.Start(repos[1:])).To(Succeed())
+		_, ok := journal.Get("github.com-1")
+		Expect(ok).To(BeFalse())
+		Expect(journal.Reached("github.com-2", state.StageListed)).To(BeTrue())
+
+		Expect(journal.Finish()).To(Succeed())
+		Expect(journal.Unfinished()).To(BeFalse())
+		Expect(path).NotTo(BeAnExistingFile())
+		Expect(journal.Finish()).To(Succeed())
+	})
+
+})
@@ -0,0 +1,140 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RepositoryState is what we know about a repository from the previous runs
+type RepositoryState struct {
+	// Head is the HEAD commit the last result was extracted from
+	Head string `json:"head"`
+	// Checksum of the last result file
+	Checksum string `json:"checksum"`
+	// Emails is the hash of the emails the last result was extracted with, see HashEmails
+	Emails string `json:"emails"`
+	// UploadedChecksum is the checksum of the last result uploaded to CodersRank
+	UploadedChecksum string `json:"uploaded_checksum"`
+}
+
+// Store persists the state of repositories between runs in a JSON file.
+// Repositories are identified with entity.Repository.UniqueID().
+type Store struct {
+	path         string
+	mutex        sync.Mutex
+	repositories map[string]RepositoryState
+}
+
+// NewStore constructor, loads the state file if it exists
+func NewStore(path string) (*Store, error) {
+	store := &Store{
+		path:         path,
+		repositories: make(map[string]RepositoryState),
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(content, &store.repositories)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Get returns the state of the repository, second value is false if the repository is unknown
+func (s *Store) Get(id string) (RepositoryState, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	repositoryState, ok := s.repositories[id]
+	return repositoryState, ok
+}
+
+// SetProcessed saves the HEAD, the result checksum and the hash of the emails of an extraction
+func (s *Store) SetProcessed(id, head, checksum, emails string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	repositoryState := s.repositories[id]
+	repositoryState.Head = head
+	repositoryState.Checksum = checksum
+	repositoryState.Emails = emails
+	s.repositories[id] = repositoryState
+	return s.save()
+}
+
+// SetUploaded saves the checksum of the uploaded results
+func (s *Store) SetUploaded(checksums map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, checksum := range checksums {
+		repositoryState := s.repositories[id]
+		repositoryState.UploadedChecksum = checksum
+		s.repositories[id] = repositoryState
+	}
+	return s.save()
+}
+
+// Written to a temporary file first, so a crash never leaves a half written state file
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.repositories, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, content)
+}
+
+func writeFileAtomic(path string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// HashEmails returns the SHA-256 hash of the email list, the order of the emails doesn't matter
+func HashEmails(emails []string) string {
+	sorted := make([]string, len(emails))
+	copy(sorted, emails)
+	sort.Strings(sorted)
+	hash := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// Checksum returns the SHA-256 checksum of the file
+func Checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,57 @@
+package state_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
+)
+
+var _ = Describe("State", func() {
+
+	var tmpPath string
+
+	BeforeEach(func() {
+		var err error
+		tmpPath, err = ioutil.TempDir("", "state_test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpPath)
+	})
+
+	It("should persist repository states between runs", func() {
+		path := filepath.Join(tmpPath, "results", "state.json")
+		store, err := state.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := store.Get("github.com-1")
+		Expect(ok).To(BeFalse())
+
+		Expect(store.SetProcessed("github.com-1", "head", "checksum", "emails")).To(Succeed())
+		Expect(store.SetUploaded(map[string]string{"github.com-1": "checksum"})).To(Succeed())
+
+		store, err = state.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		repositoryState, ok := store.Get("github.com-1")
+		Expect(ok).To(BeTrue())
+		Expect(repositoryState).To(Equal(state.RepositoryState{Head: "head", Checksum: "checksum", Emails: "emails", UploadedChecksum: "checksum"}))
+	})
+
+	It("should hash the emails regardless of their order", func() {
+		hash := state.HashEmails([]string{"me@example.com", "work@example.com"})
+		Expect(state.HashEmails([]string{"work@example.com", "me@example.com"})).To(Equal(hash))
+		Expect(state.HashEmails([]string{"me@example.com"})).NotTo(Equal(hash))
+	})
+
+	It("should calculate the checksum of a file", func() {
+		path := filepath.Join(tmpPath, "result.zip")
+		Expect(ioutil.WriteFile(path, []byte("result"), 0600)).To(Succeed())
+		Expect(state.Checksum(path)).To(Equal("f6a214f7a5fcda0c2cee9660b7fc29f5649e3c68aad48e20e950137c98913a68"))
+	})
+
+})
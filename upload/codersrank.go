@@ -3,10 +3,9 @@ package upload
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/gookit/color"
 	"io"
 	"io/ioutil"
 	"log"
@@ -15,56 +14,176 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/gookit/color"
 	"github.com/pkg/browser"
 
 	config "github.com/codersrank-org/multi_repo_repo_extractor/config"
 	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
 )
 
 // CodersrankService uploads and merge results with codersrank
 type CodersrankService interface {
-	UploadRepos(repos []*entity.Repository)
+	// UploadRepos stops when the context is cancelled, uploaded results can be merged by resuming the run.
+	// Error is returned if a result couldn't be uploaded or merged.
+	UploadRepos(ctx context.Context, repos []*entity.Repository) error
 }
 
 type codersrankService struct {
 	UploadRepoURL   string
 	UploadResultURL string
 	ProcessURL      string
-	AppPath         string
+	ResultPath      string
+	State           *state.Store
+	Journal         *state.Journal
+	Force           bool
+	Retry           retry.Policy
+	// Confirm asks the user before the browser is opened
+	Confirm func(message string) bool
 }
 
 // NewCodersrankService constructor
-func NewCodersrankService(c config.Config) CodersrankService {
+func NewCodersrankService(c config.Config, store *state.Store, journal *state.Journal) CodersrankService {
 	return &codersrankService{
 		UploadRepoURL:   "https://grpcgateway.codersrank.io/candidate/privaterepo/Upload",
 		UploadResultURL: "https://grpcgateway.codersrank.io/multi/repo/results",
 		ProcessURL:      "https://profile.codersrank.io/repo?multiToken=",
-		AppPath:         c.AppPath,
+		ResultPath:      c.ResultsPath,
+		State:           store,
+		Journal:         journal,
+		Force:           c.Force,
+		Retry:           retry.UploadPolicy,
+		Confirm:         confirm,
 	}
 }
 
-func (c *codersrankService) UploadRepos(repos []*entity.Repository) {
-	uploadResults := make(map[string]string)
+func (c *codersrankService) UploadRepos(ctx context.Context, repos []*entity.Repository) error {
+	// Repositories from different providers can have the same name, so results are kept in a list
+	uploadResults := make([]CRUploadResultWithRepoName, 0, len(repos))
+	checksums := make(map[string]string, len(repos))
+	// Names of the repositories whose results couldn't be read or uploaded
+	failed := make([]string, 0)
 	done := 1
 	for _, repo := range repos {
+		// Tokens of the results uploaded before an interruption are still valid for merging,
+		// results without a token are merged already (or haven't changed)
+		if entry, ok := c.Journal.Get(repo.UniqueID()); ok && entry.Stage == state.StageUploaded {
+			fmt.Printf("%s results were uploaded before the interruption, skipping\n", color.Info.Sprint(repo.FullName))
+			if entry.UploadToken == "" {
+				continue
+			}
+			uploadResults = append(uploadResults, CRUploadResultWithRepoName{
+				Token:    entry.UploadToken,
+				Reponame: repo.Name,
+			})
+			checksums[repo.UniqueID()] = entry.Checksum
+			continue
+		}
+		checksum, err := state.Checksum(fmt.Sprintf("%s/%s.zip", c.ResultPath, repo.UniqueID()))
+		if err != nil {
+			fmt.Printf("Couldn't read %s results, error: %s\n", repo.FullName, err.Error())
+			failed = append(failed, repo.FullName)
+			continue
+		}
+		if !c.Force && c.isUploaded(repo, checksum) {
+			fmt.Printf("%s results haven't changed since the last upload, skipping\n", color.Info.Sprint(repo.FullName))
+			err = c.Journal.SetStage(repo.UniqueID(), state.StageUploaded)
+			if err != nil {
+				fmt.Printf("Couldn't save progress of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(err.Error()))
+			}
+			continue
+		}
 		fmt.Printf("Uploading %s results (%d,%d)\n", color.Info.Sprint(repo.FullName), done, len(repos))
-		uploadToken, err := c.uploadRepo(repo.ID)
+		uploadToken, err := c.uploadRepo(ctx, repo.UniqueID())
+		if ctx.Err() != nil {
+			color.Warn.Println("Upload was interrupted, use the resume command to finish it.")
+			return nil
+		}
 		if err != nil {
-			fmt.Printf("Couldn't upload, error: %s", err.Error())
+			fmt.Printf("Couldn't upload %s results, error: %s\n", repo.FullName, err.Error())
+			failed = append(failed, repo.FullName)
 			continue
 		}
-		uploadResults[repo.Name] = uploadToken
+		uploadResults = append(uploadResults, CRUploadResultWithRepoName{
+			Token:    uploadToken,
+			Reponame: repo.Name,
+		})
+		checksums[repo.UniqueID()] = checksum
+		err = c.Journal.SetUploaded(repo.UniqueID(), uploadToken, checksum)
+		if err != nil {
+			fmt.Printf("Couldn't save progress of %s. Error: %s\n", repo.FullName, color.Warn.Sprint(err.Error()))
+		}
 		done++
 	}
-	resultToken := c.uploadResults(uploadResults)
+	if ctx.Err() != nil {
+		color.Warn.Println("Upload was interrupted, use the resume command to finish it.")
+		return nil
+	}
+	for _, name := range failed {
+		fmt.Printf("Couldn't upload: %s\n", color.Danger.Sprint(name))
+	}
+	if len(uploadResults) == 0 {
+		if len(failed) > 0 {
+			return fmt.Errorf("Couldn't upload the results of %d repositories", len(failed))
+		}
+		c.finishJournal()
+		color.Success.Println("Nothing changed since the last upload.")
+		return nil
+	}
+	resultToken, err := c.uploadResults(ctx, uploadResults)
+	if ctx.Err() != nil {
+		color.Warn.Println("Upload was interrupted, use the resume command to finish it.")
+		return nil
+	}
+	// Tokens of the uploaded results are kept in the journal, so merging can be retried by resuming
+	if err != nil {
+		return fmt.Errorf("Couldn't merge the uploaded results, use the resume command to retry. Error: %s", err.Error())
+	}
+	// Only saved after the merge, otherwise repos would be skipped without being linked
+	err = c.State.SetUploaded(checksums)
+	if err == nil {
+		merged := make([]string, 0, len(checksums))
+		for id := range checksums {
+			merged = append(merged, id)
+		}
+		err = c.Journal.SetMerged(merged)
+	}
+	if err != nil {
+		fmt.Printf("Couldn't save upload state. Error: %s\n", color.Warn.Sprint(err.Error()))
+	}
+	c.finishJournal()
 	c.processResults(resultToken)
+	if len(failed) > 0 {
+		return fmt.Errorf("Couldn't upload the results of %d repositories", len(failed))
+	}
+	return nil
+}
+
+// Run is finished when every repository is uploaded or failed, next run starts from the beginning.
+// Otherwise the journal is kept, so the rest can be retried by resuming the run.
+func (c *codersrankService) finishJournal() {
+	if !c.Journal.Done() {
+		color.Warn.Println("Some repositories weren't uploaded, use the resume command to retry them.")
+		return
+	}
+	err := c.Journal.Finish()
+	if err != nil {
+		fmt.Printf("Couldn't remove the journal of the run. Error: %s\n", color.Warn.Sprint(err.Error()))
+	}
+}
+
+func (c *codersrankService) isUploaded(repo *entity.Repository, checksum string) bool {
+	repositoryState, ok := c.State.Get(repo.UniqueID())
+	return ok && repositoryState.UploadedChecksum == checksum
 }
 
-func (c *codersrankService) uploadRepo(repoID string) (string, error) {
+func (c *codersrankService) uploadRepo(ctx context.Context, repoID string) (string, error) {
 
 	// Read file
-	filename := fmt.Sprintf("%s/%s.zip", c.getSaveResultPath(), repoID)
+	filename := fmt.Sprintf("%s/%s.zip", c.ResultPath, repoID)
 	file, err := os.Open(filename)
 	if err != nil {
 		return "", err
@@ -81,31 +200,30 @@ func (c *codersrankService) uploadRepo(repoID string) (string, error) {
 	io.Copy(part, file)
 	writer.Close()
 
-	// Create and make the request
-	request, err := http.NewRequest("POST", c.UploadRepoURL, body)
+	var result CRUploadResult
+	err = c.post(ctx, c.UploadRepoURL, writer.FormDataContentType(), body.Bytes(), &result)
 	if err != nil {
 		return "", err
 	}
-	request.Header.Add("Content-Type", writer.FormDataContentType())
+	return result.Token, nil
+}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		return "", err
+func (c *codersrankService) uploadResults(ctx context.Context, results []CRUploadResultWithRepoName) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
 	}
-	if response.StatusCode != http.StatusOK {
-		return "", errors.New("Server returned non 200 response")
+
+	multiUpload := MultiUpload{
+		Results: results,
 	}
-	defer response.Body.Close()
 
-	content, err := ioutil.ReadAll(response.Body)
+	b, err := json.Marshal(multiUpload)
 	if err != nil {
 		return "", err
 	}
 
-	// Get response and return resulting token
 	var result CRUploadResult
-	err = json.Unmarshal(content, &result)
+	err = c.post(ctx, c.UploadResultURL, "application/json", b, &result)
 	if err != nil {
 		return "", err
 	}
@@ -113,49 +231,42 @@ func (c *codersrankService) uploadRepo(repoID string) (string, error) {
 	return result.Token, nil
 }
 
-func (c *codersrankService) uploadResults(results map[string]string) string {
-
-	multiUpload := MultiUpload{}
-	multiUpload.Results = make([]CRUploadResultWithRepoName, len(results))
-
-	i := 0
-	for reponame, token := range results {
-		multiUpload.Results[i] = CRUploadResultWithRepoName{
-			Token:    token,
-			Reponame: reponame,
+// post sends the body and decodes the JSON response into v.
+// Network errors and temporary server errors are retried, the body is sent again on every attempt.
+func (c *codersrankService) post(ctx context.Context, url, contentType string, body []byte, v interface{}) error {
+	return retry.Do(ctx, c.Retry, func() error {
+		request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return retry.Permanent(err)
 		}
-		i++
-	}
-
-	b, err := json.Marshal(multiUpload)
-	if err != nil {
-		log.Fatal(err)
-	}
-	req, err := http.NewRequest("POST", c.UploadResultURL, bytes.NewBuffer(b))
-	req.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Content-Type", contentType)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	var result CRUploadResult
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return result.Token
+		client := &http.Client{}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			err = fmt.Errorf("Server returned non 200 response: %d %s", response.StatusCode, http.StatusText(response.StatusCode))
+			if !retry.TemporaryStatus(response.StatusCode) {
+				return retry.Permanent(err)
+			}
+			return retry.After(err, retry.ParseRetryAfter(response.Header.Get("Retry-After"), time.Now()))
+		}
 
+		content, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+		return retry.Permanent(json.Unmarshal(content, v))
+	})
 }
 
 func (c *codersrankService) processResults(resultToken string) {
 	browserURL := c.ProcessURL + resultToken
-	ok := confirm(fmt.Sprintf("You are being navigated to '%s'. Do you wish to proceed?", browserURL))
+	ok := c.Confirm(fmt.Sprintf("You are being navigated to '%s'. Do you wish to proceed?", browserURL))
 	if ok {
 		browser.OpenURL(browserURL)
 	} else {
@@ -182,13 +293,6 @@ func confirm(s string) bool {
 		}
 	}
 }
-func (c *codersrankService) getSaveResultPath() string {
-	resultPath := c.AppPath + "/results"
-	if _, err := os.Stat(resultPath); os.IsNotExist(err) {
-		os.Mkdir(resultPath, 0700)
-	}
-	return resultPath
-}
 
 // CRUploadResult is the result of single repo upload
 type CRUploadResult struct {
@@ -0,0 +1,284 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/codersrank-org/multi_repo_repo_extractor/entity"
+	"github.com/codersrank-org/multi_repo_repo_extractor/retry"
+	"github.com/codersrank-org/multi_repo_repo_extractor/state"
+)
+
+var _ = Describe("Codersrank", func() {
+
+	var resultPath string
+	var service *codersrankService
+
+	BeforeEach(func() {
+		var err error
+		resultPath, err = ioutil.TempDir("", "codersrank_test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(resultPath, "github.com-1.zip"), []byte("result content"), 0600)).To(Succeed())
+
+		store, err := state.NewStore(filepath.Join(resultPath, "state.json"))
+		Expect(err).NotTo(HaveOccurred())
+		journal, err := state.NewJournal(filepath.Join(resultPath, "journal.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		service = &codersrankService{
+			UploadRepoURL:   "https://grpcgateway.codersrank.io/candidate/privaterepo/Upload",
+			UploadResultURL: "https://grpcgateway.codersrank.io/multi/repo/results",
+			ResultPath:      resultPath,
+			State:           store,
+			Journal:         journal,
+			Retry:           retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Second},
+		}
+		httpmock.Activate()
+	})
+
+	AfterEach(func() {
+		httpmock.DeactivateAndReset()
+		os.RemoveAll(resultPath)
+	})
+
+	Describe("Uploading results", func() {
+		It("should retry temporary errors with the whole result", func() {
+			attempts := 0
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, func(request *http.Request) (*http.Response, error) {
+				attempts++
+				body, err := ioutil.ReadAll(request.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring("result content"))
+				if attempts <= 2 {
+					return httpmock.NewStringResponse(502, "Bad Gateway"), nil
+				}
+				return httpmock.NewStringResponse(200, `{"token": "upload-token"}`), nil
+			})
+			token, err := service.uploadRepo(context.Background(), "github.com-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("upload-token"))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(3))
+		})
+
+		It("should give up after the last attempt", func() {
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, httpmock.NewStringResponder(503, "Service Unavailable"))
+			_, err := service.uploadRepo(context.Background(), "github.com-1")
+			Expect(err).To(MatchError(ContainSubstring("503")))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(3))
+		})
+
+		It("should not retry rejected results", func() {
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, httpmock.NewStringResponder(400, "Bad Request"))
+			_, err := service.uploadRepo(context.Background(), "github.com-1")
+			Expect(err).To(MatchError(ContainSubstring("400")))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+		})
+
+		It("should wait as long as Retry-After asks before merging the results", func() {
+			response := httpmock.NewStringResponse(429, "Too Many Requests")
+			response.Header.Set("Retry-After", "1")
+			attempts := 0
+			httpmock.RegisterResponder("POST", service.UploadResultURL, func(request *http.Request) (*http.Response, error) {
+				attempts++
+				if attempts == 1 {
+					return response, nil
+				}
+				return httpmock.NewStringResponse(200, `{"token": "result-token"}`), nil
+			})
+			start := time.Now()
+			token, err := service.uploadResults(context.Background(), []CRUploadResultWithRepoName{{Token: "upload-token", Reponame: "repo"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token).To(Equal("result-token"))
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(2))
+		})
+
+		It("should return an error instead of merging after an interruption", func() {
+			httpmock.RegisterResponder("POST", service.UploadResultURL, httpmock.NewStringResponder(200, `{"token": "result-token"}`))
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := service.uploadResults(ctx, []CRUploadResultWithRepoName{{Token: "upload-token", Reponame: "repo"}})
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(httpmock.GetTotalCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Uploading repositories", func() {
+		repo := &entity.Repository{ID: "1", Name: "repo", FullName: "user/repo", Provider: "github.com"}
+
+		It("should report failed uploads instead of nothing changed", func() {
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, httpmock.NewStringResponder(400, "Bad Request"))
+			httpmock.RegisterResponder("POST", service.UploadResultURL, httpmock.NewStringResponder(200, `{"token": "result-token"}`))
+			err := service.UploadRepos(context.Background(), []*entity.Repository{repo})
+			Expect(err).To(MatchError(ContainSubstring("1 repositories")))
+			Expect(httpmock.GetCallCountInfo()["POST "+service.UploadResultURL]).To(Equal(0))
+			_, uploaded := service.State.Get(repo.UniqueID())
+			Expect(uploaded).To(BeFalse())
+		})
+
+		It("should not upload results which haven't changed since the last upload", func() {
+			checksum, err := state.Checksum(filepath.Join(resultPath, "github.com-1.zip"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.State.SetUploaded(map[string]string{repo.UniqueID(): checksum})).To(Succeed())
+			Expect(service.Journal.Start([]*entity.Repository{repo})).To(Succeed())
+
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo})).To(Succeed())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(0))
+			// Skipped repositories count as uploaded, the run is finished
+			Expect(service.Journal.Unfinished()).To(BeFalse())
+		})
+
+		It("should upload unchanged results again when forced", func() {
+			checksum, err := state.Checksum(filepath.Join(resultPath, "github.com-1.zip"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.State.SetUploaded(map[string]string{repo.UniqueID(): checksum})).To(Succeed())
+			service.Force = true
+			service.Confirm = func(string) bool { return false }
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, httpmock.NewStringResponder(200, `{"token": "upload-token"}`))
+			httpmock.RegisterResponder("POST", service.UploadResultURL, httpmock.NewStringResponder(200, `{"token": "result-token"}`))
+
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo})).To(Succeed())
+			Expect(httpmock.GetCallCountInfo()["POST "+service.UploadRepoURL]).To(Equal(1))
+			Expect(httpmock.GetCallCountInfo()["POST "+service.UploadResultURL]).To(Equal(1))
+		})
+
+		It("should upload results which changed since the last upload", func() {
+			Expect(service.State.SetUploaded(map[string]string{repo.UniqueID(): "previous checksum"})).To(Succeed())
+			service.Confirm = func(string) bool { return false }
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, httpmock.NewStringResponder(200, `{"token": "upload-token"}`))
+			httpmock.RegisterResponder("POST", service.UploadResultURL, httpmock.NewStringResponder(200, `{"token": "result-token"}`))
+
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo})).To(Succeed())
+			Expect(httpmock.GetCallCountInfo()["POST "+service.UploadRepoURL]).To(Equal(1))
+			repositoryState, ok := service.State.Get(repo.UniqueID())
+			Expect(ok).To(BeTrue())
+			Expect(repositoryState.UploadedChecksum).NotTo(Equal("previous checksum"))
+		})
+
+		It("should reuse the tokens of the uploaded results when an interrupted run is resumed", func() {
+			second := &entity.Repository{ID: "2", Name: "second", FullName: "user/second", Provider: "github.com"}
+			Expect(ioutil.WriteFile(filepath.Join(resultPath, "github.com-2.zip"), []byte("second content"), 0600)).To(Succeed())
+			// Extraction of this one failed, it has no result to upload
+			failing := &entity.Repository{ID: "3", Name: "failing", FullName: "user/failing", Provider: "github.com"}
+			Expect(service.Journal.Start([]*entity.Repository{repo, failing, second})).To(Succeed())
+			Expect(service.Journal.SetStage(failing.UniqueID(), state.StageFailed)).To(Succeed())
+			confirmations := 0
+			service.Confirm = func(string) bool {
+				confirmations++
+				return false
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			uploads := make([]string, 0)
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, func(request *http.Request) (*http.Response, error) {
+				body, err := ioutil.ReadAll(request.Body)
+				Expect(err).NotTo(HaveOccurred())
+				if strings.Contains(string(body), "github.com-2.zip") {
+					uploads = append(uploads, "github.com-2")
+					// Interrupted while the second result is uploaded
+					if ctx.Err() == nil {
+						cancel()
+						return httpmock.NewStringResponse(503, "Service Unavailable"), nil
+					}
+					return httpmock.NewStringResponse(200, `{"token": "token-2"}`), nil
+				}
+				uploads = append(uploads, "github.com-1")
+				return httpmock.NewStringResponse(200, `{"token": "token-1"}`), nil
+			})
+			var merged MultiUpload
+			httpmock.RegisterResponder("POST", service.UploadResultURL, func(request *http.Request) (*http.Response, error) {
+				Expect(json.NewDecoder(request.Body).Decode(&merged)).To(Succeed())
+				return httpmock.NewStringResponse(200, `{"token": "result-token"}`), nil
+			})
+
+			Expect(service.UploadRepos(ctx, []*entity.Repository{repo, second})).To(Succeed())
+			Expect(uploads).To(Equal([]string{"github.com-1", "github.com-2"}))
+			Expect(httpmock.GetCallCountInfo()["POST "+service.UploadResultURL]).To(Equal(0))
+			Expect(filepath.Join(resultPath, "journal.json")).To(BeAnExistingFile())
+
+			// Resumed by a new process
+			journal, err := state.NewJournal(filepath.Join(resultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(journal.Unfinished()).To(BeTrue())
+			service.Journal = journal
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo, second})).To(Succeed())
+			Expect(uploads).To(Equal([]string{"github.com-1", "github.com-2", "github.com-2"}))
+			Expect(merged.Results).To(Equal([]CRUploadResultWithRepoName{{Token: "token-1", Reponame: "repo"}, {Token: "token-2", Reponame: "second"}}))
+			Expect(confirmations).To(Equal(1))
+			// Failed repository doesn't keep the run unfinished
+			Expect(journal.Unfinished()).To(BeFalse())
+			Expect(filepath.Join(resultPath, "journal.json")).NotTo(BeAnExistingFile())
+			for _, id := range []string{"github.com-1", "github.com-2"} {
+				repositoryState, ok := service.State.Get(id)
+				Expect(ok).To(BeTrue())
+				Expect(repositoryState.UploadedChecksum).NotTo(BeEmpty())
+			}
+		})
+
+		It("should not merge the merged results again when the run is resumed", func() {
+			second := &entity.Repository{ID: "2", Name: "second", FullName: "user/second", Provider: "github.com"}
+			Expect(ioutil.WriteFile(filepath.Join(resultPath, "github.com-2.zip"), []byte("second content"), 0600)).To(Succeed())
+			Expect(service.Journal.Start([]*entity.Repository{repo, second})).To(Succeed())
+			service.Confirm = func(string) bool { return false }
+
+			secondStatus := 400
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, func(request *http.Request) (*http.Response, error) {
+				body, err := ioutil.ReadAll(request.Body)
+				Expect(err).NotTo(HaveOccurred())
+				if strings.Contains(string(body), "github.com-2.zip") {
+					return httpmock.NewStringResponse(secondStatus, `{"token": "token-2"}`), nil
+				}
+				return httpmock.NewStringResponse(200, `{"token": "token-1"}`), nil
+			})
+			merges := make([]MultiUpload, 0)
+			httpmock.RegisterResponder("POST", service.UploadResultURL, func(request *http.Request) (*http.Response, error) {
+				var merged MultiUpload
+				Expect(json.NewDecoder(request.Body).Decode(&merged)).To(Succeed())
+				merges = append(merges, merged)
+				return httpmock.NewStringResponse(200, `{"token": "result-token"}`), nil
+			})
+
+			// First result is merged, the second one failed
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo, second})).NotTo(Succeed())
+			Expect(service.Journal.Unfinished()).To(BeTrue())
+
+			secondStatus = 200
+			journal, err := state.NewJournal(filepath.Join(resultPath, "journal.json"))
+			Expect(err).NotTo(HaveOccurred())
+			service.Journal = journal
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo, second})).To(Succeed())
+			Expect(merges).To(Equal([]MultiUpload{
+				{Results: []CRUploadResultWithRepoName{{Token: "token-1", Reponame: "repo"}}},
+				{Results: []CRUploadResultWithRepoName{{Token: "token-2", Reponame: "second"}}},
+			}))
+			Expect(journal.Unfinished()).To(BeFalse())
+		})
+
+		It("should keep the journal when an upload failed, so it can be retried", func() {
+			Expect(service.Journal.Start([]*entity.Repository{repo})).To(Succeed())
+			httpmock.RegisterResponder("POST", service.UploadRepoURL, httpmock.NewStringResponder(400, "Bad Request"))
+			Expect(service.UploadRepos(context.Background(), []*entity.Repository{repo})).NotTo(Succeed())
+			Expect(service.Journal.Unfinished()).To(BeTrue())
+			Expect(filepath.Join(resultPath, "journal.json")).To(BeAnExistingFile())
+		})
+
+		It("should report results which couldn't be read", func() {
+			missing := &entity.Repository{ID: "2", Name: "missing", FullName: "user/missing", Provider: "github.com"}
+			err := service.UploadRepos(context.Background(), []*entity.Repository{missing})
+			Expect(err).To(HaveOccurred())
+			Expect(httpmock.GetTotalCallCount()).To(Equal(0))
+		})
+	})
+
+})